@@ -0,0 +1,74 @@
+// Command m17rx decodes a 48 kHz M17 baseband recording, as a WAV file or
+// raw 16-bit samples on stdin, through the web client's RX pipeline. The
+// server messages are printed as JSON lines and the decoded audio can be
+// written to a file as raw 8 kHz 16-bit PCM.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"sync"
+
+	log "github.com/kc1awv/m17-webclient/internal/logger"
+	"github.com/kc1awv/m17-webclient/internal/transport"
+)
+
+func main() {
+	audioPath := flag.String("audio", "", "write decoded audio to this file as raw 8 kHz s16le PCM")
+	flag.Parse()
+
+	var in io.Reader = os.Stdin
+	if path := flag.Arg(0); path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatal("failed to open input", "err", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	audioOut := io.Discard
+	if *audioPath != "" {
+		f, err := os.Create(*audioPath)
+		if err != nil {
+			log.Fatal("failed to create audio output", "err", err)
+		}
+		defer f.Close()
+		audioOut = f
+	}
+
+	s := &transport.Session{
+		Callsign:         "M17RX",
+		UsePCM:           true,
+		OutgoingAudio:    make(chan []byte, transport.OutgoingAudioBufSize),
+		OutgoingMessages: make(chan transport.ServerMessage, transport.OutgoingMessagesBufSize),
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for frame := range s.OutgoingAudio {
+			if _, err := audioOut.Write(frame); err != nil {
+				log.Error("failed to write audio", "err", err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		enc := json.NewEncoder(os.Stdout)
+		for msg := range s.OutgoingMessages {
+			_ = enc.Encode(msg)
+		}
+	}()
+
+	err := s.ReceiveRF(in)
+	close(s.OutgoingAudio)
+	close(s.OutgoingMessages)
+	wg.Wait()
+	if err != nil {
+		log.Fatal("failed to decode baseband", "err", err)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/kc1awv/m17-webclient/internal/config"
 	"github.com/kc1awv/m17-webclient/internal/cors"
 	log "github.com/kc1awv/m17-webclient/internal/logger"
+	"github.com/kc1awv/m17-webclient/internal/m17"
 	"github.com/kc1awv/m17-webclient/internal/reflector"
 	"github.com/kc1awv/m17-webclient/internal/status"
 	"github.com/kc1awv/m17-webclient/internal/transport"
@@ -47,20 +48,57 @@ func main() {
 	store := reflector.NewListStore()
 	store.Init()
 
-	originValidator := cors.NewOriginValidator(cfg.AllowedOrigins)
-	wsCfg := transport.WebSocketConfig{
-		OriginValidator: originValidator,
-		PingInterval:    cfg.WSPingInterval,
-		PongWait:        cfg.WSPongWait,
-		ServerName:      cfg.ServerName,
-		NewReflectorClient: func(ctx context.Context, addr, callsign string, module byte) (*reflector.ReflectorClient, error) {
-			rc, err := reflector.NewReflectorClient(ctx, addr, callsign, module)
+	reconnect := reflector.DefaultReconnectPolicy
+	reconnect.MaxDelay = cfg.ReconnectMaxDelay
+	reconnect.MaxAttempts = cfg.ReconnectMaxAttempts
+
+	type connectFunc = func(ctx context.Context, addr, callsign string, module byte) (*reflector.ReflectorClient, error)
+	withSetup := func(connect connectFunc) connectFunc {
+		return func(ctx context.Context, addr, callsign string, module byte) (*reflector.ReflectorClient, error) {
+			rc, err := connect(ctx, addr, callsign, module)
 			if err != nil {
 				return nil, err
 			}
 			rc.Designator = store.LookupDesignator(addr)
+			if cfg.Reconnect {
+				rc.EnableReconnect(reconnect)
+			}
 			return rc, nil
-		},
+		}
+	}
+
+	newReflectorClient, newListenClient := reflector.NewReflectorClient, reflector.NewListenClient
+	if cfg.ReflectorPort != 0 {
+		udp, err := reflector.ListenMux(cfg.ReflectorPort)
+		if err != nil {
+			log.Fatal("failed to bind REFLECTOR_PORT", "err", err)
+		}
+		defer udp.Close()
+		if cfg.LinkCallsign == "" {
+			log.Warn("REFLECTOR_PORT is set without LINK_CALLSIGN; sessions on a reflector that is already connected will use random ports")
+		}
+		newReflectorClient, newListenClient = udp.NewReflectorClient, udp.NewListenClient
+	}
+
+	originValidator := cors.NewOriginValidator(cfg.AllowedOrigins)
+	wsCfg := transport.WebSocketConfig{
+		OriginValidator:    originValidator,
+		PingInterval:       cfg.WSPingInterval,
+		PongWait:           cfg.WSPongWait,
+		ServerName:         cfg.ServerName,
+		SigningKeyDir:      cfg.SigningKeyDir,
+		PublicKeyDir:       cfg.PublicKeyDir,
+		BasebandDir:        cfg.BasebandDir,
+		NewReflectorClient: withSetup(newReflectorClient),
+		NewListenClient:    withSetup(newListenClient),
+	}
+	if cfg.LinkCallsign != "" {
+		if _, err := m17.ValidateCallsign(cfg.LinkCallsign); err != nil {
+			log.Fatal("invalid LINK_CALLSIGN", "err", err)
+		}
+		wsCfg.Links = transport.NewLinkManager(cfg.LinkCallsign)
+		wsCfg.Links.NewReflectorClient = wsCfg.NewReflectorClient
+		wsCfg.Links.NewListenClient = wsCfg.NewListenClient
 	}
 
 	addr := cfg.Address()
@@ -83,6 +121,16 @@ func main() {
 
 	store.StartReflectorUpdater(rootCtx)
 
+	if cfg.ProbeInterval > 0 {
+		prober := reflector.NewProber(store)
+		prober.Interval = cfg.ProbeInterval
+		prober.Connect = newListenClient
+		if cfg.ProbeCONN {
+			prober.Connect = newReflectorClient
+		}
+		prober.Start(rootCtx)
+	}
+
 	mux := http.NewServeMux()
 
 	mux.Handle("/metrics", promhttp.Handler())
@@ -99,6 +147,12 @@ func main() {
 		}
 	})
 
+	mux.HandleFunc("/api/reflectors/status", func(w http.ResponseWriter, r *http.Request) {
+		if err := writeJSONResponse(w, store.HostFileStatus()); err != nil {
+			log.Error("failed to encode host file status", "err", err)
+		}
+	})
+
 	mux.HandleFunc("/api/reflectors/modules", func(w http.ResponseWriter, r *http.Request) {
 		slug := r.URL.Query().Get("slug")
 		if slug == "" {
@@ -29,6 +29,31 @@ type Config struct {
 	MaxSessions    int
 	WSPingInterval time.Duration
 	WSPongWait     time.Duration
+	SigningKeyDir  string
+	PublicKeyDir   string
+	// BasebandDir, when set, is where transmitted streams are recorded as
+	// M17 baseband WAV files.
+	BasebandDir string
+
+	// Reconnect enables reconnecting to a reflector that stopped pinging
+	// or disconnected the client, backing off up to ReconnectMaxDelay
+	// between attempts.
+	Reconnect            bool
+	ReconnectMaxDelay    time.Duration
+	ReconnectMaxAttempts int
+
+	// ReflectorPort, when set, is the one UDP port all reflector clients
+	// share instead of each binding a random port.
+	ReflectorPort int
+
+	// ProbeInterval, when set, enables probing every reflector in the host
+	// file; ProbeCONN probes with CONN instead of LSTN.
+	ProbeInterval time.Duration
+	ProbeCONN     bool
+
+	// LinkCallsign, when set, makes sessions on the same reflector module
+	// share one connection made with this callsign.
+	LinkCallsign string
 }
 
 func (c Config) Address() string {
@@ -86,7 +111,54 @@ func Load() (Config, error) {
 		}
 	}
 
+	cfg.SigningKeyDir = os.Getenv("SIGNING_KEY_DIR")
+	cfg.PublicKeyDir = os.Getenv("PUBLIC_KEY_DIR")
+	cfg.BasebandDir = os.Getenv("RF_BASEBAND_DIR")
+	cfg.LinkCallsign = strings.ToUpper(strings.TrimSpace(os.Getenv("LINK_CALLSIGN")))
+
+	if v := os.Getenv("REFLECTOR_PORT"); v != "" {
+		p, err := strconv.Atoi(v)
+		if err != nil || p <= 0 || p > 65535 {
+			errs = append(errs, fmt.Errorf("invalid REFLECTOR_PORT %q: %w", v, err))
+		} else {
+			cfg.ReflectorPort = p
+		}
+	}
+
+	if v := os.Getenv("REFLECTOR_RECONNECT"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid REFLECTOR_RECONNECT %q: %w", v, err))
+		} else {
+			cfg.Reconnect = b
+		}
+	}
+	if v := os.Getenv("REFLECTOR_PROBE_CONN"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid REFLECTOR_PROBE_CONN %q: %w", v, err))
+		} else {
+			cfg.ProbeCONN = b
+		}
+	}
+	if v := os.Getenv("REFLECTOR_RECONNECT_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			errs = append(errs, fmt.Errorf("invalid REFLECTOR_RECONNECT_MAX_ATTEMPTS %q: %w", v, err))
+		} else {
+			cfg.ReconnectMaxAttempts = n
+		}
+	}
+
 	var err error
+	cfg.ReconnectMaxDelay, err = parseDurationEnv("REFLECTOR_RECONNECT_MAX_DELAY", time.Minute)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.ProbeInterval, err = parseDurationEnv("REFLECTOR_PROBE_INTERVAL", 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
 	cfg.ReadTimeout, err = parseDurationEnv("SERVER_READ_TIMEOUT", 15*time.Second)
 	if err != nil {
 		errs = append(errs, err)
@@ -22,6 +22,12 @@ func TestLoadDefaults(t *testing.T) {
 	t.Setenv("SERVER_IDLE_TIMEOUT", "")
 	t.Setenv("WS_PING_INTERVAL", "")
 	t.Setenv("WS_PONG_WAIT", "")
+	t.Setenv("REFLECTOR_RECONNECT", "")
+	t.Setenv("REFLECTOR_RECONNECT_MAX_DELAY", "")
+	t.Setenv("REFLECTOR_RECONNECT_MAX_ATTEMPTS", "")
+	t.Setenv("REFLECTOR_PORT", "")
+	t.Setenv("REFLECTOR_PROBE_INTERVAL", "")
+	t.Setenv("REFLECTOR_PROBE_CONN", "")
 
 	cfg, err := Load()
 	if err != nil {
@@ -65,6 +71,9 @@ func TestLoadDefaults(t *testing.T) {
 	if cfg.WSPongWait != 60*time.Second {
 		t.Fatalf("WSPongWait = %v; want 60s", cfg.WSPongWait)
 	}
+	if cfg.Reconnect || cfg.ReconnectMaxDelay != time.Minute {
+		t.Fatalf("reconnect = %v, %v; want false, 1m", cfg.Reconnect, cfg.ReconnectMaxDelay)
+	}
 }
 
 func TestLoadParsing(t *testing.T) {
@@ -80,6 +89,13 @@ func TestLoadParsing(t *testing.T) {
 	t.Setenv("SERVER_IDLE_TIMEOUT", "90s")
 	t.Setenv("WS_PING_INTERVAL", "5s")
 	t.Setenv("WS_PONG_WAIT", "10s")
+	t.Setenv("REFLECTOR_RECONNECT", "true")
+	t.Setenv("REFLECTOR_RECONNECT_MAX_DELAY", "2m")
+	t.Setenv("REFLECTOR_RECONNECT_MAX_ATTEMPTS", "5")
+	t.Setenv("LINK_CALLSIGN", " n0link ")
+	t.Setenv("REFLECTOR_PORT", "17000")
+	t.Setenv("REFLECTOR_PROBE_INTERVAL", "10m")
+	t.Setenv("REFLECTOR_PROBE_CONN", "true")
 
 	cfg, err := Load()
 	if err != nil {
@@ -125,6 +141,18 @@ func TestLoadParsing(t *testing.T) {
 	if cfg.WSPongWait != 10*time.Second {
 		t.Fatalf("WSPongWait = %v; want 10s", cfg.WSPongWait)
 	}
+	if !cfg.Reconnect || cfg.ReconnectMaxDelay != 2*time.Minute || cfg.ReconnectMaxAttempts != 5 {
+		t.Fatalf("reconnect = %v, %v, %d; want true, 2m, 5", cfg.Reconnect, cfg.ReconnectMaxDelay, cfg.ReconnectMaxAttempts)
+	}
+	if cfg.ProbeInterval != 10*time.Minute || !cfg.ProbeCONN {
+		t.Fatalf("probe = %v, %v; want 10m, true", cfg.ProbeInterval, cfg.ProbeCONN)
+	}
+	if cfg.ReflectorPort != 17000 {
+		t.Fatalf("ReflectorPort = %d; want 17000", cfg.ReflectorPort)
+	}
+	if cfg.LinkCallsign != "N0LINK" {
+		t.Fatalf("LinkCallsign = %q; want N0LINK", cfg.LinkCallsign)
+	}
 }
 
 func TestLoadInvalidPort(t *testing.T) {
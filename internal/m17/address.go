@@ -0,0 +1,149 @@
+package m17
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Address is a 48-bit M17 address.
+//
+//	0x000000000000                  invalid
+//	0x000000000001 - 0xEE6B27FFFFFF base-40 callsign, up to 9 characters
+//	0xEE6B28000000 - 0xF46108FFFFFF '#' prefixed callsign, up to 8 characters
+//	0xF46109000000 - 0xFFFFFFFFFFFE reserved
+//	0xFFFFFFFFFFFF                  broadcast (@ALL)
+type Address uint64
+
+const (
+	AddressInvalid   Address = 0
+	AddressBroadcast Address = 0xFFFFFFFFFFFF
+
+	BroadcastCallsign = "@ALL"
+
+	base40Max     Address = 40*40*40*40*40*40*40*40*40 - 1
+	extendedStart Address = base40Max + 1
+	extendedMax   Address = extendedStart + 40*40*40*40*40*40*40*40 - 1
+)
+
+func ParseAddress(s string) (Address, error) {
+	if a, ok := parseHexAddress(s); ok {
+		return a, nil
+	}
+	s = strings.ToUpper(s)
+
+	switch {
+	case s == BroadcastCallsign:
+		return AddressBroadcast, nil
+	case strings.HasPrefix(s, "#"):
+		if len(s) > 9 {
+			return 0, fmt.Errorf("extended callsign too long: max 8 characters after #")
+		}
+		v, err := encodeBase40(s[1:])
+		if err != nil {
+			return 0, err
+		}
+		if v == 0 {
+			return 0, fmt.Errorf("empty extended callsign")
+		}
+		return extendedStart + v, nil
+	default:
+		if len(s) > 9 {
+			return 0, fmt.Errorf("callsign too long: max 9 characters")
+		}
+		return encodeBase40(s)
+	}
+}
+
+// parseHexAddress parses the hex form String gives reserved addresses,
+// "0x" and 1-12 hex digits. Anything else, such as a callsign that starts
+// with 0X, is left to the callsign parse.
+func parseHexAddress(s string) (Address, bool) {
+	if !strings.HasPrefix(s, "0x") || len(s) < 3 || len(s) > 14 {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(s[2:], 16, 48)
+	if err != nil {
+		return 0, false
+	}
+	return Address(v), true
+}
+
+func AddressFromBytes(b []byte) Address {
+	if len(b) != 6 {
+		return AddressInvalid
+	}
+	var a Address
+	for _, v := range b {
+		a = a<<8 | Address(v)
+	}
+	return a
+}
+
+func (a Address) Bytes() []byte {
+	out := make([]byte, 6)
+	for i := 5; i >= 0; i-- {
+		out[i] = byte(a)
+		a >>= 8
+	}
+	return out
+}
+
+func (a Address) IsBroadcast() bool { return a == AddressBroadcast }
+
+func (a Address) IsExtended() bool { return a >= extendedStart && a <= extendedMax }
+
+func (a Address) IsReserved() bool { return a > extendedMax && a < AddressBroadcast }
+
+// String renders the address the way it is typed by users. Reserved
+// addresses have no text form and are rendered as hex so they still
+// round-trip through ParseAddress.
+func (a Address) String() string {
+	switch {
+	case a == AddressInvalid:
+		return ""
+	case a <= base40Max:
+		return decodeBase40(a)
+	case a.IsExtended():
+		return "#" + decodeBase40(a-extendedStart)
+	case a.IsBroadcast():
+		return BroadcastCallsign
+	default:
+		return fmt.Sprintf("0x%012X", uint64(a))
+	}
+}
+
+func encodeBase40(s string) (Address, error) {
+	var a Address
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		var val Address
+		switch {
+		case c == ' ':
+			val = 0
+		case 'A' <= c && c <= 'Z':
+			val = Address(c-'A') + 1
+		case '0' <= c && c <= '9':
+			val = Address(c-'0') + 27
+		case c == '-':
+			val = 37
+		case c == '/':
+			val = 38
+		case c == '.':
+			val = 39
+		default:
+			return 0, fmt.Errorf("invalid character in callsign: %c", c)
+		}
+		a = a*40 + val
+	}
+	return a, nil
+}
+
+func decodeBase40(a Address) string {
+	chars := make([]byte, 0, 9)
+	for a > 0 {
+		chars = append(chars, base40Chars[a%40])
+		a /= 40
+	}
+	return strings.TrimSpace(string(chars))
+}
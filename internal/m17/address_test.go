@@ -0,0 +1,84 @@
+package m17
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAddressRoundTrip(t *testing.T) {
+	tests := []string{
+		"KC1AWV",
+		"M17-AWV A",
+		"@ALL",
+		"#M17-TEST",
+		"#A",
+		"0xF50000000001",
+	}
+	for _, in := range tests {
+		addr, err := ParseAddress(in)
+		if err != nil {
+			t.Fatalf("ParseAddress(%s): %v", in, err)
+		}
+		if got := addr.String(); got != in {
+			t.Errorf("roundtrip mismatch: got %s, want %s", got, in)
+		}
+		if got := AddressFromBytes(addr.Bytes()); got != addr {
+			t.Errorf("byte roundtrip mismatch for %s: got %#x, want %#x", in, uint64(got), uint64(addr))
+		}
+	}
+}
+
+func TestParseAddressHexPrefix(t *testing.T) {
+	tests := map[string]string{
+		"0xF50000000001": "0xF50000000001",
+		"0x1":            "A",
+		"0XF5":           "0XF5",
+		"0xray":          "0XRAY",
+		"0x0-1":          "0X0-1",
+	}
+	for in, want := range tests {
+		addr, err := ParseAddress(in)
+		if err != nil {
+			t.Fatalf("ParseAddress(%s): %v", in, err)
+		}
+		if got := addr.String(); got != want {
+			t.Errorf("ParseAddress(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestAddressRanges(t *testing.T) {
+	bcast, _ := ParseAddress("@all")
+	if !bcast.IsBroadcast() || !bytes.Equal(bcast.Bytes(), []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}) {
+		t.Fatalf("unexpected broadcast encoding %x", bcast.Bytes())
+	}
+
+	ext, _ := ParseAddress("#........")
+	if !ext.IsExtended() || ext.IsReserved() {
+		t.Fatalf("expected extended address, got %#x", uint64(ext))
+	}
+	if ext != extendedMax {
+		t.Fatalf("largest extended address %#x, want %#x", uint64(ext), uint64(extendedMax))
+	}
+
+	max, _ := ParseAddress("999999999")
+	if max > base40Max || max.IsExtended() {
+		t.Fatalf("base-40 callsign outside base-40 range: %#x", uint64(max))
+	}
+
+	if !(extendedMax + 1).IsReserved() {
+		t.Fatalf("expected reserved address after extended range")
+	}
+	if AddressInvalid.String() != "" {
+		t.Fatalf("expected empty string for invalid address")
+	}
+}
+
+func TestParseAddressErrors(t *testing.T) {
+	invalid := []string{"TOO-LONGCS", "#TOOLONGXX", "#", "BAD$", "0x1234567890ABC"}
+	for _, in := range invalid {
+		if _, err := ParseAddress(in); err == nil {
+			t.Errorf("expected error for %s", in)
+		}
+	}
+}
@@ -19,6 +19,7 @@ type Codec2 struct {
 
 const (
 	MODE_3200 = C.CODEC2_MODE_3200
+	MODE_1600 = C.CODEC2_MODE_1600
 )
 
 func New(mode int) (*Codec2, error) {
@@ -9,6 +9,7 @@ import (
 
 const (
 	MagicCONN = "CONN"
+	MagicLSTN = "LSTN"
 	MagicACKN = "ACKN"
 	MagicNACK = "NACK"
 	MagicPING = "PING"
@@ -26,6 +27,7 @@ const (
 	CtrlPING
 	CtrlPONG
 	CtrlDISC
+	CtrlLSTN
 )
 
 func ParseControlPacket(data []byte) (ControlType, string, byte, error) {
@@ -43,6 +45,14 @@ func ParseControlPacket(data []byte) (ControlType, string, byte, error) {
 		cs := DecodeCallsign(data[4:10])
 		module := data[10]
 		return CtrlCONN, cs, module, nil
+
+	case MagicLSTN:
+		if len(data) < 11 {
+			return CtrlUnknown, "", 0, errors.New("invalid LSTN length")
+		}
+		cs := DecodeCallsign(data[4:10])
+		module := data[10]
+		return CtrlLSTN, cs, module, nil
 	case MagicACKN:
 		if len(data) < 4 {
 			return CtrlUnknown, "", 0, errors.New("invalid ACKN length")
@@ -92,6 +102,15 @@ func BuildCONN(callsign string, module byte) ([]byte, error) {
 	return append(pkt, module), nil
 }
 
+// BuildLSTN builds a receive-only connect request.
+func BuildLSTN(callsign string, module byte) ([]byte, error) {
+	pkt, err := buildControlPacket(MagicLSTN, callsign)
+	if err != nil {
+		return nil, err
+	}
+	return append(pkt, module), nil
+}
+
 func BuildPONG(callsign string) ([]byte, error) {
 	return buildControlPacket(MagicPONG, callsign)
 }
@@ -140,62 +159,16 @@ func ValidateCallsign(callsign string) (string, error) {
 }
 
 func EncodeCallsign(callsign string) ([]byte, error) {
-	callsign = strings.ToUpper(callsign)
-
-	if len(callsign) < 9 {
-		callsign = callsign + strings.Repeat(" ", 9-len(callsign))
-	} else if len(callsign) > 9 {
-		return nil, fmt.Errorf("callsign too long: max 9 characters")
-	}
-
-	address := uint64(0)
-	for i := len(callsign) - 1; i >= 0; i-- {
-		c := callsign[i]
-		val := 0
-		switch {
-		case c == ' ':
-			val = 0
-		case 'A' <= c && c <= 'Z':
-			val = int(c-'A') + 1
-		case '0' <= c && c <= '9':
-			val = int(c-'0') + 27
-		case c == '-':
-			val = 37
-		case c == '/':
-			val = 38
-		case c == '.':
-			val = 39
-		default:
-			return nil, fmt.Errorf("invalid character in callsign: %c", c)
-		}
-		address = address*40 + uint64(val)
-	}
-
-	result := make([]byte, 6)
-	for i := 5; i >= 0; i-- {
-		result[i] = byte(address & 0xFF)
-		address >>= 8
+	addr, err := ParseAddress(callsign)
+	if err != nil {
+		return nil, err
 	}
-
-	return result, nil
+	return addr.Bytes(), nil
 }
 
 func DecodeCallsign(encoded []byte) string {
 	if len(encoded) != 6 {
 		return ""
 	}
-
-	address := uint64(0)
-	for _, b := range encoded {
-		address = address*256 + uint64(b)
-	}
-
-	chars := make([]rune, 0, 9)
-	for address > 0 {
-		idx := address % 40
-		chars = append(chars, rune(base40Chars[idx]))
-		address /= 40
-	}
-
-	return strings.TrimSpace(string(chars))
+	return AddressFromBytes(encoded).String()
 }
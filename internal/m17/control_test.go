@@ -52,6 +52,21 @@ func TestValidateCallsign(t *testing.T) {
 	}
 }
 
+func TestLSTNRoundTrip(t *testing.T) {
+	packet, err := BuildLSTN("SWL", 'C')
+	if err != nil {
+		t.Fatalf("BuildLSTN failed: %v", err)
+	}
+
+	ctrlType, callsign, module, err := ParseControlPacket(packet)
+	if err != nil {
+		t.Fatalf("ParseControlPacket failed: %v", err)
+	}
+	if ctrlType != CtrlLSTN || callsign != "SWL" || module != 'C' {
+		t.Errorf("got %v %s %c, want LSTN SWL C", ctrlType, callsign, module)
+	}
+}
+
 func TestControlPacketRoundTrip(t *testing.T) {
 	packet, err := BuildCONN("KC1ABC", 'A')
 	if err != nil {
@@ -0,0 +1,137 @@
+package m17
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+)
+
+// ErrNoKey is returned for encrypted streams when no matching key is loaded.
+var ErrNoKey = errors.New("encrypted stream, no key")
+
+// Encryption subtypes select the key length for EncryptionAES and the seed
+// length for EncryptionScrambler.
+const (
+	AES128 uint8 = iota
+	AES192
+	AES256
+)
+
+const (
+	Scrambler8 uint8 = iota
+	Scrambler16
+	Scrambler24
+)
+
+// Key is a stream encryption key. AES keys are 16, 24 or 32 bytes; the
+// scrambler takes a non-zero 1, 2 or 3 byte seed.
+type Key struct {
+	Type    EncryptionType
+	Subtype uint8
+
+	block cipher.Block
+	seed  uint32
+}
+
+func NewKey(typ EncryptionType, key []byte) (*Key, error) {
+	switch typ {
+	case EncryptionAES:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AES key: %w", err)
+		}
+		return &Key{Type: typ, Subtype: uint8(len(key)/8 - 2), block: block}, nil
+	case EncryptionScrambler:
+		if len(key) < 1 || len(key) > 3 {
+			return nil, fmt.Errorf("invalid scrambler seed: must be 1-3 bytes")
+		}
+		var seed uint32
+		for _, b := range key {
+			seed = seed<<8 | uint32(b)
+		}
+		if seed == 0 {
+			return nil, fmt.Errorf("invalid scrambler seed: must be non-zero")
+		}
+		return &Key{Type: typ, Subtype: uint8(len(key) - 1), seed: seed}, nil
+	default:
+		return nil, fmt.Errorf("unsupported encryption type: %s", typ)
+	}
+}
+
+// Matches reports whether the key can decrypt a stream of type t.
+func (k *Key) Matches(t LSFType) bool {
+	return k != nil && t.Encryption == k.Type && t.EncryptionSubtype == k.Subtype
+}
+
+// scramblerTaps are the Fibonacci LFSR feedback taps for the 8, 16 and 24
+// bit scramblers (x^8+x^6+x^5+x^4+1, x^16+x^15+x^13+x^4+1 and
+// x^24+x^23+x^22+x^17+1).
+var scramblerTaps = [3][]uint{
+	{7, 5, 4, 3},
+	{15, 14, 12, 3},
+	{23, 22, 21, 16},
+}
+
+// streamCipher applies a key to successive payloads. The scrambler
+// keystream runs across the whole stream, 128 bits per frame, so the LFSR
+// state at the start of the last frame is kept to avoid replaying it from
+// the seed on every frame.
+type streamCipher struct {
+	key      *Key
+	frameNum uint16
+	lfsr     uint32
+}
+
+func newStreamCipher(k *Key) *streamCipher {
+	if k == nil {
+		return nil
+	}
+	return &streamCipher{key: k, lfsr: k.seed}
+}
+
+// apply encrypts or decrypts payload in place. For AES the 16-byte counter
+// block is the 14-byte nonce from META followed by the frame number.
+func (c *streamCipher) apply(payload *[16]byte, nonce [14]byte, frameNum uint16) {
+	frameNum &= 0x7FFF
+
+	if c.key.Type == EncryptionAES {
+		var iv [16]byte
+		copy(iv[:14], nonce[:])
+		iv[14] = byte(frameNum >> 8)
+		iv[15] = byte(frameNum)
+		cipher.NewCTR(c.key.block, iv[:]).XORKeyStream(payload[:], payload[:])
+		return
+	}
+
+	if frameNum < c.frameNum {
+		c.frameNum = 0
+		c.lfsr = c.key.seed
+	}
+	for ; c.frameNum < frameNum; c.frameNum++ {
+		for i := 0; i < 128; i++ {
+			c.step()
+		}
+	}
+
+	lfsr := c.lfsr
+	for i := range payload {
+		var ks byte
+		for b := 0; b < 8; b++ {
+			ks = ks<<1 | byte(c.step())
+		}
+		payload[i] ^= ks
+	}
+	c.lfsr = lfsr
+}
+
+func (c *streamCipher) step() uint32 {
+	taps := scramblerTaps[c.key.Subtype]
+	var bit uint32
+	for _, t := range taps {
+		bit ^= c.lfsr >> t
+	}
+	bit &= 1
+	c.lfsr = (c.lfsr<<1 | bit) & (1<<(8*(c.key.Subtype+1)) - 1)
+	return bit
+}
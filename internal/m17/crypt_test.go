@@ -0,0 +1,116 @@
+package m17
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+)
+
+func TestNewKey(t *testing.T) {
+	tests := []struct {
+		typ     EncryptionType
+		key     []byte
+		subtype uint8
+		wantErr bool
+	}{
+		{EncryptionAES, make([]byte, 16), AES128, false},
+		{EncryptionAES, make([]byte, 24), AES192, false},
+		{EncryptionAES, make([]byte, 32), AES256, false},
+		{EncryptionAES, make([]byte, 20), 0, true},
+		{EncryptionScrambler, []byte{0x01}, Scrambler8, false},
+		{EncryptionScrambler, []byte{0x01, 0x02}, Scrambler16, false},
+		{EncryptionScrambler, []byte{0x01, 0x02, 0x03}, Scrambler24, false},
+		{EncryptionScrambler, []byte{0x00}, 0, true},
+		{EncryptionScrambler, make([]byte, 4), 0, true},
+		{EncryptionOther, []byte{0x01}, 0, true},
+	}
+	for _, tt := range tests {
+		k, err := NewKey(tt.typ, tt.key)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s %d bytes: expected error", tt.typ, len(tt.key))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s %d bytes: %v", tt.typ, len(tt.key), err)
+		}
+		if k.Subtype != tt.subtype {
+			t.Errorf("%s %d bytes: subtype %d, want %d", tt.typ, len(tt.key), k.Subtype, tt.subtype)
+		}
+		if !k.Matches(LSFType{Encryption: tt.typ, EncryptionSubtype: tt.subtype}) {
+			t.Errorf("%s %d bytes: key does not match its own type", tt.typ, len(tt.key))
+		}
+	}
+}
+
+func TestAESCounterBlock(t *testing.T) {
+	raw := []byte("0123456789abcdef")
+	k, err := NewKey(EncryptionAES, raw)
+	if err != nil {
+		t.Fatalf("NewKey: %v", err)
+	}
+	nonce := [14]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14}
+
+	// The keystream for frame 0x8005 (last frame 5) is AES(nonce || 0x0005).
+	block, _ := aes.NewCipher(raw)
+	iv := append(nonce[:], 0x00, 0x05)
+	want := make([]byte, 16)
+	block.Encrypt(want, iv)
+
+	var payload [16]byte
+	newStreamCipher(k).apply(&payload, nonce, 0x8005)
+	if !bytes.Equal(payload[:], want) {
+		t.Fatalf("keystream %X, want %X", payload, want)
+	}
+}
+
+func TestScramblerMaximalLength(t *testing.T) {
+	for subtype, seed := range [][]byte{{0x01}, {0x00, 0x01}, {0x00, 0x00, 0x01}} {
+		k, err := NewKey(EncryptionScrambler, seed)
+		if err != nil {
+			t.Fatalf("NewKey: %v", err)
+		}
+		c := newStreamCipher(k)
+		period := 1<<(8*(subtype+1)) - 1
+		for i := 1; i <= period; i++ {
+			c.step()
+			if c.lfsr == k.seed && i != period {
+				t.Fatalf("subtype %d: period %d, want %d", subtype, i, period)
+			}
+		}
+		if c.lfsr != k.seed {
+			t.Fatalf("subtype %d: state did not return to seed after %d steps", subtype, period)
+		}
+	}
+}
+
+func TestScramblerFrameKeystream(t *testing.T) {
+	k, err := NewKey(EncryptionScrambler, []byte{0xAB, 0xCD})
+	if err != nil {
+		t.Fatalf("NewKey: %v", err)
+	}
+
+	sequential := newStreamCipher(k)
+	var want [16]byte
+	for fn := uint16(0); fn <= 5; fn++ {
+		want = [16]byte{}
+		sequential.apply(&want, [14]byte{}, fn)
+	}
+
+	// Late entry at frame 5 must produce the same keystream.
+	var got [16]byte
+	newStreamCipher(k).apply(&got, [14]byte{}, 5)
+	if got != want {
+		t.Fatalf("late entry keystream %X, want %X", got, want)
+	}
+
+	// Applying twice restores the plaintext.
+	plain := [16]byte{1, 2, 3}
+	buf := plain
+	sequential.apply(&buf, [14]byte{}, 5)
+	sequential.apply(&buf, [14]byte{}, 5)
+	if buf != plain {
+		t.Fatal("scrambling twice did not restore the payload")
+	}
+}
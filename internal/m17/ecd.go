@@ -0,0 +1,36 @@
+package m17
+
+import "fmt"
+
+// ECD is the Extended Callsign Data META payload. Originator is the station
+// that keyed up and Via is the reflector the traffic was relayed through.
+type ECD struct {
+	Originator string
+	Via        string
+}
+
+func EncodeECD(e ECD) ([14]byte, error) {
+	var meta [14]byte
+	if e.Originator != "" {
+		enc, err := EncodeCallsign(e.Originator)
+		if err != nil {
+			return meta, fmt.Errorf("originator: %w", err)
+		}
+		copy(meta[0:6], enc)
+	}
+	if e.Via != "" {
+		enc, err := EncodeCallsign(e.Via)
+		if err != nil {
+			return meta, fmt.Errorf("via: %w", err)
+		}
+		copy(meta[6:12], enc)
+	}
+	return meta, nil
+}
+
+func DecodeECD(meta [14]byte) ECD {
+	return ECD{
+		Originator: DecodeCallsign(meta[0:6]),
+		Via:        DecodeCallsign(meta[6:12]),
+	}
+}
@@ -0,0 +1,24 @@
+package m17
+
+import "testing"
+
+func TestECDRoundTrip(t *testing.T) {
+	tests := []ECD{
+		{Originator: "KC1AWV", Via: "M17-AWV A"},
+		{Originator: "N0CALL"},
+		{},
+	}
+	for _, in := range tests {
+		meta, err := EncodeECD(in)
+		if err != nil {
+			t.Fatalf("EncodeECD(%+v): %v", in, err)
+		}
+		if out := DecodeECD(meta); out != in {
+			t.Errorf("roundtrip mismatch: got %+v, want %+v", out, in)
+		}
+	}
+
+	if _, err := EncodeECD(ECD{Originator: "BAD$"}); err == nil {
+		t.Fatalf("expected error for invalid callsign")
+	}
+}
@@ -0,0 +1,186 @@
+package m17
+
+import (
+	"fmt"
+	"math"
+)
+
+type StationType uint8
+
+const (
+	StationFixed StationType = iota
+	StationMobile
+	StationHandheld
+	StationOther StationType = 15
+)
+
+func (st StationType) String() string {
+	switch st {
+	case StationFixed:
+		return "fixed"
+	case StationMobile:
+		return "mobile"
+	case StationHandheld:
+		return "handheld"
+	default:
+		return "other"
+	}
+}
+
+func ParseStationType(s string) (StationType, error) {
+	switch s {
+	case "fixed":
+		return StationFixed, nil
+	case "mobile":
+		return StationMobile, nil
+	case "handheld":
+		return StationHandheld, nil
+	case "other":
+		return StationOther, nil
+	default:
+		return 0, fmt.Errorf("unknown station type: %s", s)
+	}
+}
+
+const (
+	GNSSSourceM17Client uint8 = 0
+	GNSSSourceOpenRTX   uint8 = 1
+	GNSSSourceOther     uint8 = 15
+)
+
+// GNSS is the position META payload. Altitude is in feet above sea level,
+// speed in miles per hour and bearing in whole degrees.
+//
+//	bits 0-3     data source
+//	bits 4-7     station type
+//	bits 8-11    validity (position, altitude, velocity, radius)
+//	bits 12-14   radius
+//	bits 15-23   bearing
+//	bits 24-47   latitude, signed, 90/2^23 degree steps
+//	bits 48-71   longitude, signed, 180/2^23 degree steps
+//	bits 72-87   altitude, 0.5 ft steps offset by -500 ft
+//	bits 88-99   speed, 0.5 mph steps
+//	bits 100-111 reserved
+type GNSS struct {
+	Source      uint8
+	StationType StationType
+	Latitude    float64
+	Longitude   float64
+	Altitude    float64
+	Bearing     uint16
+	Speed       float64
+	Radius      uint8
+
+	HasPosition bool
+	HasAltitude bool
+	HasVelocity bool
+	HasRadius   bool
+}
+
+const (
+	gnssValidPosition = 1 << 3
+	gnssValidAltitude = 1 << 2
+	gnssValidVelocity = 1 << 1
+	gnssValidRadius   = 1 << 0
+
+	gnssCoordScale = 1<<23 - 1
+)
+
+func EncodeGNSS(g GNSS) ([14]byte, error) {
+	var meta [14]byte
+
+	if g.Source > 15 {
+		return meta, fmt.Errorf("invalid GNSS data source: %d", g.Source)
+	}
+	if g.StationType > 15 {
+		return meta, fmt.Errorf("invalid station type: %d", g.StationType)
+	}
+	if g.Latitude < -90 || g.Latitude > 90 || math.IsNaN(g.Latitude) {
+		return meta, fmt.Errorf("latitude out of range: %f", g.Latitude)
+	}
+	if g.Longitude < -180 || g.Longitude > 180 || math.IsNaN(g.Longitude) {
+		return meta, fmt.Errorf("longitude out of range: %f", g.Longitude)
+	}
+	if g.Bearing > 359 {
+		return meta, fmt.Errorf("bearing out of range: %d", g.Bearing)
+	}
+	if g.Radius > 7 {
+		return meta, fmt.Errorf("radius out of range: %d", g.Radius)
+	}
+
+	var validity byte
+	if g.HasPosition {
+		validity |= gnssValidPosition
+	}
+	if g.HasAltitude {
+		validity |= gnssValidAltitude
+	}
+	if g.HasVelocity {
+		validity |= gnssValidVelocity
+	}
+	if g.HasRadius {
+		validity |= gnssValidRadius
+	}
+
+	lat := int32(math.Round(g.Latitude / 90 * gnssCoordScale))
+	lon := int32(math.Round(g.Longitude / 180 * gnssCoordScale))
+	alt := clampUint(math.Round(g.Altitude*2)+1000, 0xFFFF)
+	speed := clampUint(math.Round(g.Speed*2), 0xFFF)
+
+	meta[0] = g.Source<<4 | byte(g.StationType)
+	meta[1] = validity<<4 | g.Radius<<1 | byte(g.Bearing>>8)
+	meta[2] = byte(g.Bearing)
+	putInt24(meta[3:6], lat)
+	putInt24(meta[6:9], lon)
+	meta[9] = byte(alt >> 8)
+	meta[10] = byte(alt)
+	meta[11] = byte(speed >> 4)
+	meta[12] = byte(speed&0xF) << 4
+
+	return meta, nil
+}
+
+func DecodeGNSS(meta [14]byte) GNSS {
+	validity := meta[1] >> 4
+	alt := uint16(meta[9])<<8 | uint16(meta[10])
+	speed := uint16(meta[11])<<4 | uint16(meta[12]>>4)
+
+	return GNSS{
+		Source:      meta[0] >> 4,
+		StationType: StationType(meta[0] & 0xF),
+		Radius:      (meta[1] >> 1) & 0x7,
+		Bearing:     uint16(meta[1]&1)<<8 | uint16(meta[2]),
+		Latitude:    float64(getInt24(meta[3:6])) * 90 / gnssCoordScale,
+		Longitude:   float64(getInt24(meta[6:9])) * 180 / gnssCoordScale,
+		Altitude:    (float64(alt) - 1000) / 2,
+		Speed:       float64(speed) / 2,
+		HasPosition: validity&gnssValidPosition != 0,
+		HasAltitude: validity&gnssValidAltitude != 0,
+		HasVelocity: validity&gnssValidVelocity != 0,
+		HasRadius:   validity&gnssValidRadius != 0,
+	}
+}
+
+func clampUint(v float64, max uint32) uint32 {
+	if v < 0 {
+		return 0
+	}
+	if v > float64(max) {
+		return max
+	}
+	return uint32(v)
+}
+
+func putInt24(b []byte, v int32) {
+	b[0] = byte(v >> 16)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v)
+}
+
+func getInt24(b []byte) int32 {
+	v := int32(b[0])<<16 | int32(b[1])<<8 | int32(b[2])
+	if v&0x800000 != 0 {
+		v -= 1 << 24
+	}
+	return v
+}
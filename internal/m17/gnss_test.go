@@ -0,0 +1,66 @@
+package m17
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGNSSRoundTrip(t *testing.T) {
+	in := GNSS{
+		Source:      GNSSSourceM17Client,
+		StationType: StationMobile,
+		Latitude:    41.7152,
+		Longitude:   -72.7274,
+		Altitude:    350.5,
+		Bearing:     271,
+		Speed:       42.5,
+		HasPosition: true,
+		HasAltitude: true,
+		HasVelocity: true,
+	}
+	meta, err := EncodeGNSS(in)
+	if err != nil {
+		t.Fatalf("EncodeGNSS: %v", err)
+	}
+	out := DecodeGNSS(meta)
+
+	if math.Abs(out.Latitude-in.Latitude) > 1e-4 || math.Abs(out.Longitude-in.Longitude) > 1e-4 {
+		t.Errorf("position mismatch: got %f,%f want %f,%f", out.Latitude, out.Longitude, in.Latitude, in.Longitude)
+	}
+	if out.Altitude != in.Altitude || out.Speed != in.Speed || out.Bearing != in.Bearing {
+		t.Errorf("altitude/speed/bearing mismatch: got %+v", out)
+	}
+	if out.StationType != in.StationType || out.Source != in.Source {
+		t.Errorf("station/source mismatch: got %+v", out)
+	}
+	if !out.HasPosition || !out.HasAltitude || !out.HasVelocity || out.HasRadius {
+		t.Errorf("validity mismatch: got %+v", out)
+	}
+}
+
+func TestGNSSExtremes(t *testing.T) {
+	for _, c := range [][2]float64{{90, 180}, {-90, -180}, {0, 0}} {
+		meta, err := EncodeGNSS(GNSS{Latitude: c[0], Longitude: c[1], HasPosition: true})
+		if err != nil {
+			t.Fatalf("EncodeGNSS(%v): %v", c, err)
+		}
+		out := DecodeGNSS(meta)
+		if math.Abs(out.Latitude-c[0]) > 1e-4 || math.Abs(out.Longitude-c[1]) > 1e-4 {
+			t.Errorf("got %f,%f want %f,%f", out.Latitude, out.Longitude, c[0], c[1])
+		}
+	}
+}
+
+func TestGNSSInvalid(t *testing.T) {
+	invalid := []GNSS{
+		{Latitude: 90.5},
+		{Longitude: -181},
+		{Bearing: 360},
+		{Radius: 8},
+	}
+	for _, g := range invalid {
+		if _, err := EncodeGNSS(g); err == nil {
+			t.Errorf("expected error for %+v", g)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package m17
+
+type DataType uint8
+
+const (
+	DataTypeReserved DataType = iota
+	DataTypeData
+	DataTypeVoice
+	DataTypeVoiceData
+)
+
+func (d DataType) String() string {
+	switch d {
+	case DataTypeData:
+		return "data"
+	case DataTypeVoice:
+		return "voice"
+	case DataTypeVoiceData:
+		return "voice+data"
+	default:
+		return "reserved"
+	}
+}
+
+type EncryptionType uint8
+
+const (
+	EncryptionNone EncryptionType = iota
+	EncryptionScrambler
+	EncryptionAES
+	EncryptionOther
+)
+
+func (e EncryptionType) String() string {
+	switch e {
+	case EncryptionNone:
+		return "none"
+	case EncryptionScrambler:
+		return "scrambler"
+	case EncryptionAES:
+		return "aes"
+	default:
+		return "other"
+	}
+}
+
+// Encryption subtypes for EncryptionNone select the META field contents.
+const (
+	MetaText uint8 = iota
+	MetaGNSS
+	MetaECD
+	MetaReserved
+)
+
+const MaxCAN = 15
+
+// LSFType is the decoded 16-bit TYPE field of a Link Setup Frame.
+//
+//	bit 0      packet/stream indicator (1 = stream)
+//	bits 1-2   data type
+//	bits 3-4   encryption type
+//	bits 5-6   encryption subtype
+//	bits 7-10  Channel Access Number
+//	bit 11     signed stream
+type LSFType struct {
+	Stream            bool
+	DataType          DataType
+	Encryption        EncryptionType
+	EncryptionSubtype uint8
+	CAN               uint8
+	Signed            bool
+}
+
+func (t LSFType) Encode() uint16 {
+	var v uint16
+	if t.Stream {
+		v |= 1
+	}
+	v |= uint16(t.DataType&0x3) << 1
+	v |= uint16(t.Encryption&0x3) << 3
+	v |= uint16(t.EncryptionSubtype&0x3) << 5
+	v |= uint16(t.CAN&0xF) << 7
+	if t.Signed {
+		v |= 1 << 11
+	}
+	return v
+}
+
+func DecodeLSFType(v uint16) LSFType {
+	return LSFType{
+		Stream:            v&1 != 0,
+		DataType:          DataType((v >> 1) & 0x3),
+		Encryption:        EncryptionType((v >> 3) & 0x3),
+		EncryptionSubtype: uint8((v >> 5) & 0x3),
+		CAN:               uint8((v >> 7) & 0xF),
+		Signed:            v&(1<<11) != 0,
+	}
+}
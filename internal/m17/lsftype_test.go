@@ -0,0 +1,41 @@
+package m17
+
+import "testing"
+
+func TestLSFTypeVoiceStreamEncoding(t *testing.T) {
+	typ := LSFType{Stream: true, DataType: DataTypeVoice}
+	if got := typ.Encode(); got != 0x0005 {
+		t.Fatalf("expected 0x0005, got %#04x", got)
+	}
+}
+
+func TestLSFTypeRoundTrip(t *testing.T) {
+	tests := []LSFType{
+		{Stream: true, DataType: DataTypeVoice},
+		{Stream: true, DataType: DataTypeVoiceData, CAN: 7},
+		{Stream: false, DataType: DataTypeData, CAN: 15},
+		{Stream: true, DataType: DataTypeVoice, Encryption: EncryptionAES, EncryptionSubtype: 2, Signed: true},
+		{Stream: true, DataType: DataTypeVoice, Encryption: EncryptionNone, EncryptionSubtype: MetaGNSS},
+	}
+	for _, tt := range tests {
+		got := DecodeLSFType(tt.Encode())
+		if got != tt {
+			t.Errorf("roundtrip mismatch: got %+v, want %+v", got, tt)
+		}
+	}
+}
+
+func TestParseLSFType(t *testing.T) {
+	typ := LSFType{Stream: true, DataType: DataTypeVoiceData, CAN: 3, Signed: true}
+	lsf, err := BuildLSF("DST", "SRC", typ, [14]byte{})
+	if err != nil {
+		t.Fatalf("BuildLSF: %v", err)
+	}
+	parsed, err := ParseLSF(lsf[:])
+	if err != nil {
+		t.Fatalf("ParseLSF: %v", err)
+	}
+	if parsed.Type != typ {
+		t.Fatalf("type mismatch: got %+v, want %+v", parsed.Type, typ)
+	}
+}
@@ -0,0 +1,107 @@
+package m17
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+const MagicPacket = "M17P"
+
+// Packet types carried in the first byte of a packet-mode payload.
+const (
+	PacketTypeRaw     byte = 0x00
+	PacketTypeAX25    byte = 0x01
+	PacketTypeAPRS    byte = 0x02
+	PacketType6LoWPAN byte = 0x03
+	PacketTypeIPv4    byte = 0x04
+	PacketTypeSMS     byte = 0x05
+	PacketTypeWinlink byte = 0x06
+)
+
+// MaxPacketPayload is the largest packet-mode payload, including the
+// packet type byte and the trailing CRC.
+const MaxPacketPayload = 825
+
+// MaxSMSLength leaves room for the packet type, NUL terminator and CRC.
+const MaxSMSLength = MaxPacketPayload - 4
+
+type Packet struct {
+	LSF  *LSF
+	Type byte
+	Data []byte
+}
+
+func BuildPacket(lsf [30]byte, ptype byte, data []byte) ([]byte, error) {
+	if len(data)+3 > MaxPacketPayload {
+		return nil, fmt.Errorf("packet payload too long: %d bytes", len(data))
+	}
+
+	buf := make([]byte, 0, 4+30+len(data)+3)
+	buf = append(buf, MagicPacket...)
+	buf = append(buf, lsf[:]...)
+
+	start := len(buf)
+	buf = append(buf, ptype)
+	buf = append(buf, data...)
+	buf = binary.BigEndian.AppendUint16(buf, CRC16(buf[start:]))
+
+	return buf, nil
+}
+
+func ParsePacket(data []byte) (*Packet, error) {
+	if len(data) < 4+30+3 {
+		return nil, fmt.Errorf("invalid packet length")
+	}
+	if string(data[0:4]) != MagicPacket {
+		return nil, fmt.Errorf("invalid MAGIC")
+	}
+
+	lsf, err := ParseLSF(data[4:34])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse LSF: %w", err)
+	}
+
+	payload := data[34:]
+	if len(payload) > MaxPacketPayload {
+		return nil, fmt.Errorf("packet payload too long: %d bytes", len(payload))
+	}
+	crcExpected := binary.BigEndian.Uint16(payload[len(payload)-2:])
+	if CRC16(payload[:len(payload)-2]) != crcExpected {
+		return nil, fmt.Errorf("CRC mismatch")
+	}
+
+	return &Packet{
+		LSF:  lsf,
+		Type: payload[0],
+		Data: append([]byte(nil), payload[1:len(payload)-2]...),
+	}, nil
+}
+
+func BuildSMS(dst, src string, can uint8, text string) ([]byte, error) {
+	if len(text) > MaxSMSLength {
+		return nil, fmt.Errorf("SMS too long: max %d bytes", MaxSMSLength)
+	}
+	if can > MaxCAN {
+		return nil, fmt.Errorf("invalid CAN %d: max %d", can, MaxCAN)
+	}
+
+	typ := LSFType{Stream: false, DataType: DataTypeData, CAN: can}
+	lsf, err := BuildLSF(dst, src, typ, [14]byte{})
+	if err != nil {
+		return nil, err
+	}
+	return BuildPacket(lsf, PacketTypeSMS, append([]byte(text), 0))
+}
+
+// SMSText returns the text of an SMS packet without its NUL terminator.
+func (p *Packet) SMSText() (string, bool) {
+	if p.Type != PacketTypeSMS {
+		return "", false
+	}
+	text := p.Data
+	if i := bytes.IndexByte(text, 0); i >= 0 {
+		text = text[:i]
+	}
+	return string(text), true
+}
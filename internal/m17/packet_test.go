@@ -0,0 +1,46 @@
+package m17
+
+import "testing"
+
+func TestSMSRoundTrip(t *testing.T) {
+	raw, err := BuildSMS("@ALL", "KC1AWV", 2, "hello world")
+	if err != nil {
+		t.Fatalf("BuildSMS: %v", err)
+	}
+	if string(raw[0:4]) != MagicPacket {
+		t.Fatalf("unexpected magic %q", raw[0:4])
+	}
+
+	p, err := ParsePacket(raw)
+	if err != nil {
+		t.Fatalf("ParsePacket: %v", err)
+	}
+	if p.LSF.Source != "KC1AWV" || p.LSF.Destination != "@ALL" {
+		t.Fatalf("unexpected addresses %s -> %s", p.LSF.Source, p.LSF.Destination)
+	}
+	if p.LSF.Type.Stream || p.LSF.Type.DataType != DataTypeData || p.LSF.Type.CAN != 2 {
+		t.Fatalf("unexpected LSF type %+v", p.LSF.Type)
+	}
+	text, ok := p.SMSText()
+	if !ok || text != "hello world" {
+		t.Fatalf("unexpected SMS text %q (ok=%v)", text, ok)
+	}
+}
+
+func TestParsePacketCRCMismatch(t *testing.T) {
+	raw, err := BuildSMS("N0CALL", "KC1AWV", 0, "test")
+	if err != nil {
+		t.Fatalf("BuildSMS: %v", err)
+	}
+	raw[len(raw)-4] ^= 0xFF
+	if _, err := ParsePacket(raw); err == nil {
+		t.Fatalf("expected CRC error")
+	}
+}
+
+func TestBuildPacketTooLong(t *testing.T) {
+	lsf, _ := BuildLSF("N0CALL", "KC1AWV", LSFType{DataType: DataTypeData}, [14]byte{})
+	if _, err := BuildPacket(lsf, PacketTypeRaw, make([]byte, MaxPacketPayload)); err == nil {
+		t.Fatalf("expected error for oversized payload")
+	}
+}
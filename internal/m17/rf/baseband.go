@@ -0,0 +1,107 @@
+package rf
+
+import "math"
+
+const (
+	SampleRate       = 48000
+	SymbolRate       = 4800
+	SamplesPerSymbol = SampleRate / SymbolRate
+
+	rrcAlpha = 0.5
+	rrcSpan  = 8
+
+	// basebandGain scales a +1 symbol to int16 sample units, leaving
+	// headroom for RRC overshoot on +3/-3 symbols.
+	basebandGain = 7168
+)
+
+// rrcTaps is the root raised cosine pulse shaping filter, normalized to
+// unit energy so that the cascade of transmit and matched filters has
+// unity gain at the symbol instant.
+var rrcTaps = func() []float64 {
+	n := rrcSpan*SamplesPerSymbol + 1
+	taps := make([]float64, n)
+	var energy float64
+	for i := range taps {
+		t := float64(i-n/2) / SamplesPerSymbol
+		var h float64
+		switch {
+		case t == 0:
+			h = 1 - rrcAlpha + 4*rrcAlpha/math.Pi
+		case math.Abs(math.Abs(t)-1/(4*rrcAlpha)) < 1e-9:
+			h = rrcAlpha / math.Sqrt2 * ((1+2/math.Pi)*math.Sin(math.Pi/(4*rrcAlpha)) +
+				(1-2/math.Pi)*math.Cos(math.Pi/(4*rrcAlpha)))
+		default:
+			h = (math.Sin(math.Pi*t*(1-rrcAlpha)) + 4*rrcAlpha*t*math.Cos(math.Pi*t*(1+rrcAlpha))) /
+				(math.Pi * t * (1 - (4*rrcAlpha*t)*(4*rrcAlpha*t)))
+		}
+		taps[i] = h
+		energy += h * h
+	}
+	norm := math.Sqrt(energy)
+	for i := range taps {
+		taps[i] /= norm
+	}
+	return taps
+}()
+
+// rrcFilter runs rrcTaps over a stream of samples.
+type rrcFilter struct {
+	hist []float64
+	pos  int
+}
+
+func newRRCFilter() *rrcFilter {
+	return &rrcFilter{hist: make([]float64, len(rrcTaps))}
+}
+
+func (f *rrcFilter) push(x float64) float64 {
+	f.hist[f.pos] = x
+	var acc float64
+	idx := f.pos
+	for _, tap := range rrcTaps {
+		acc += tap * f.hist[idx]
+		idx--
+		if idx < 0 {
+			idx = len(f.hist) - 1
+		}
+	}
+	f.pos = (f.pos + 1) % len(f.hist)
+	return acc
+}
+
+// Shaper upsamples 4FSK symbols to 48 kHz and applies the RRC filter. It
+// keeps filter state between calls so a transmission can be shaped in
+// pieces.
+type Shaper struct {
+	filter *rrcFilter
+}
+
+func NewShaper() *Shaper {
+	return &Shaper{filter: newRRCFilter()}
+}
+
+func (s *Shaper) push(x float64) int16 {
+	v := math.Round(s.filter.push(x) * math.Sqrt(SamplesPerSymbol) * basebandGain)
+	return int16(max(math.MinInt16, min(math.MaxInt16, v)))
+}
+
+func (s *Shaper) Shape(syms []int8) []int16 {
+	out := make([]int16, 0, len(syms)*SamplesPerSymbol)
+	for _, sym := range syms {
+		out = append(out, s.push(float64(sym)))
+		for i := 1; i < SamplesPerSymbol; i++ {
+			out = append(out, s.push(0))
+		}
+	}
+	return out
+}
+
+// Flush drains the filter so the tail of the last symbol is emitted.
+func (s *Shaper) Flush() []int16 {
+	out := make([]int16, len(rrcTaps))
+	for i := range out {
+		out[i] = s.push(0)
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+package rf
+
+import "math"
+
+// Puncture patterns applied to the rate 1/2 convolutional code output.
+var (
+	// puncturePattern1 is used for the LSF, 488 -> 368 bits.
+	puncturePattern1 = []uint8{
+		1,
+		1, 0, 1, 1, 1, 0, 1, 1, 1, 0, 1, 1, 1, 0, 1, 1, 1, 0, 1, 1,
+		1, 0, 1, 1, 1, 0, 1, 1, 1, 0, 1, 1, 1, 0, 1, 1, 1, 0, 1, 1,
+		1, 0, 1, 1, 1, 0, 1, 1, 1, 0, 1, 1, 1, 0, 1, 1, 1, 0, 1, 1,
+	}
+	// puncturePattern2 is used for stream frames, 296 -> 272 bits.
+	puncturePattern2 = []uint8{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0}
+)
+
+// convEncode runs the K=5 convolutional code (G1 = 1+D^3+D^4,
+// G2 = 1+D+D^2+D^4) over bits, appending four flush bits, and punctures
+// the output with pattern.
+func convEncode(bits []uint8, pattern []uint8) []uint8 {
+	in := make([]uint8, 4+len(bits)+4)
+	copy(in[4:], bits)
+
+	out := make([]uint8, 0, 2*(len(bits)+4))
+	p := 0
+	emit := func(b uint8) {
+		if pattern[p] == 1 {
+			out = append(out, b)
+		}
+		p = (p + 1) % len(pattern)
+	}
+
+	for i := 0; i < len(bits)+4; i++ {
+		g1 := (in[i+4] + in[i+1] + in[i]) & 1
+		g2 := (in[i+4] + in[i+3] + in[i+2] + in[i]) & 1
+		emit(g1)
+		emit(g2)
+	}
+	return out
+}
+
+// depuncture re-inserts erasures (zero soft bits) where pattern dropped a
+// bit, returning n soft bits.
+func depuncture(soft []float64, pattern []uint8, n int) []float64 {
+	out := make([]float64, n)
+	p, j := 0, 0
+	for i := range out {
+		if pattern[p] == 1 && j < len(soft) {
+			out[i] = soft[j]
+			j++
+		}
+		p = (p + 1) % len(pattern)
+	}
+	return out
+}
+
+// viterbiDecode decodes the soft output of convEncode. Soft bits range from
+// -1 (certain 0) to +1 (certain 1) with 0 meaning erased. The four flush
+// bits are removed from the result.
+func viterbiDecode(soft []float64) []uint8 {
+	const states = 16
+	steps := len(soft) / 2
+
+	var metric [states]float64
+	for s := 1; s < states; s++ {
+		metric[s] = math.Inf(-1)
+	}
+	prev := make([][states]uint8, steps)
+
+	for i := 0; i < steps; i++ {
+		var next [states]float64
+		for s := range next {
+			next[s] = math.Inf(-1)
+		}
+		for s := 0; s < states; s++ {
+			if math.IsInf(metric[s], -1) {
+				continue
+			}
+			d1, d2, d3, d4 := (s>>3)&1, (s>>2)&1, (s>>1)&1, s&1
+			for b := 0; b < 2; b++ {
+				g1 := b ^ d3 ^ d4
+				g2 := b ^ d1 ^ d2 ^ d4
+				m := metric[s] + branchMetric(soft[2*i], g1) + branchMetric(soft[2*i+1], g2)
+				ns := b<<3 | s>>1
+				if m > next[ns] {
+					next[ns] = m
+					prev[i][ns] = uint8(s)
+				}
+			}
+		}
+		metric = next
+	}
+
+	bits := make([]uint8, steps)
+	s := 0
+	for i := steps - 1; i >= 0; i-- {
+		bits[i] = uint8(s >> 3)
+		s = int(prev[i][s])
+	}
+	return bits[:max(0, steps-4)]
+}
+
+func branchMetric(soft float64, bit int) float64 {
+	if bit == 1 {
+		return soft
+	}
+	return -soft
+}
@@ -0,0 +1,133 @@
+package rf
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	SyncLSF    uint16 = 0x55F7
+	SyncStream uint16 = 0xFF5D
+	SyncPacket uint16 = 0x75FF
+	SyncBERT   uint16 = 0xDF55
+
+	eotPattern uint16 = 0x555D
+
+	// SymbolsPerFrame is the length of every 40 ms frame including its
+	// 16-bit sync word.
+	SymbolsPerFrame = 192
+)
+
+// bytesToBits expands bytes into one bit per element, MSB first.
+func bytesToBits(data []byte) []uint8 {
+	bits := make([]uint8, 0, len(data)*8)
+	for _, b := range data {
+		for i := 7; i >= 0; i-- {
+			bits = append(bits, (b>>i)&1)
+		}
+	}
+	return bits
+}
+
+func bitsToBytes(bits []uint8) []byte {
+	out := make([]byte, (len(bits)+7)/8)
+	for i, b := range bits {
+		out[i/8] |= (b & 1) << (7 - i%8)
+	}
+	return out
+}
+
+// bitsToSymbols maps dibits to 4FSK symbols: 01 +3, 00 +1, 10 -1, 11 -3.
+func bitsToSymbols(bits []uint8) []int8 {
+	syms := make([]int8, 0, len(bits)/2)
+	for i := 0; i+1 < len(bits); i += 2 {
+		switch bits[i]<<1 | bits[i+1] {
+		case 0b01:
+			syms = append(syms, 3)
+		case 0b00:
+			syms = append(syms, 1)
+		case 0b10:
+			syms = append(syms, -1)
+		default:
+			syms = append(syms, -3)
+		}
+	}
+	return syms
+}
+
+func wordSymbols(w uint16) []int8 {
+	return bitsToSymbols(bytesToBits([]byte{byte(w >> 8), byte(w)}))
+}
+
+// Preamble returns the 40 ms +3/-3 preamble sent before an LSF.
+func Preamble() []int8 {
+	syms := make([]int8, SymbolsPerFrame)
+	for i := range syms {
+		if i%2 == 0 {
+			syms[i] = 3
+		} else {
+			syms[i] = -3
+		}
+	}
+	return syms
+}
+
+// EOT returns the 40 ms end of transmission marker.
+func EOT() []int8 {
+	syms := make([]int8, 0, SymbolsPerFrame)
+	for len(syms) < SymbolsPerFrame {
+		syms = append(syms, wordSymbols(eotPattern)...)
+	}
+	return syms
+}
+
+func finishFrame(sync uint16, bits []uint8) []int8 {
+	if len(bits) != frameBits {
+		panic(fmt.Sprintf("rf: frame has %d bits, want %d", len(bits), frameBits))
+	}
+	bits = interleave(bits)
+	decorrelate(bits)
+	return append(wordSymbols(sync), bitsToSymbols(bits)...)
+}
+
+// EncodeLSFFrame returns the symbols of a Link Setup Frame, including the
+// LSF sync word.
+func EncodeLSFFrame(lsf [30]byte) []int8 {
+	return finishFrame(SyncLSF, convEncode(bytesToBits(lsf[:]), puncturePattern1))
+}
+
+// encodeLICH splits one 40-bit LSF chunk plus its 3-bit counter into four
+// Golay(24,12) codewords.
+func encodeLICH(lsf [30]byte, counter uint8) []uint8 {
+	var raw [6]byte
+	copy(raw[:5], lsf[int(counter)*5:int(counter)*5+5])
+	raw[5] = counter << 5
+
+	words := [4]uint16{
+		uint16(raw[0])<<4 | uint16(raw[1])>>4,
+		uint16(raw[1]&0x0F)<<8 | uint16(raw[2]),
+		uint16(raw[3])<<4 | uint16(raw[4])>>4,
+		uint16(raw[4]&0x0F)<<8 | uint16(raw[5]),
+	}
+
+	bits := make([]uint8, 0, 96)
+	for _, w := range words {
+		cw := golayEncode(w)
+		for i := 23; i >= 0; i-- {
+			bits = append(bits, uint8(cw>>i)&1)
+		}
+	}
+	return bits
+}
+
+// EncodeStreamFrame returns the symbols of a stream frame carrying LICH
+// chunk counter (0-5) of lsf, including the stream sync word.
+func EncodeStreamFrame(lsf [30]byte, counter uint8, frameNum uint16, payload [16]byte) []int8 {
+	var data [18]byte
+	binary.BigEndian.PutUint16(data[0:2], frameNum)
+	copy(data[2:], payload[:])
+
+	bits := encodeLICH(lsf, counter%6)
+	bits = append(bits, convEncode(bytesToBits(data[:]), puncturePattern2)...)
+	return finishFrame(SyncStream, bits)
+}
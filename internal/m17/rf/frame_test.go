@@ -0,0 +1,168 @@
+package rf
+
+import (
+	"encoding/hex"
+	"math/bits"
+	"slices"
+	"testing"
+)
+
+// Regression vectors: an @ALL voice stream LSF from N0CALL and the bits of
+// each frame after its sync word. These are not published M17 or libm17
+// vectors. They were cross-checked against a second encoder written from
+// the tables of the specification, which shares any misreading of it, so
+// they should be replaced with libm17 output when that is at hand.
+const (
+	refLSF       = "FFFFFFFFFFFF00004B13D10600050000000000000000000000000000A0F6"
+	refLSFFrame  = "173DAA918AD7A56BFB2ECE90FAC0C5755E881C05D307E4626C3B3BD804EA5AE2990BD082F3348697F31C6CAC78A2"
+	refStream0   = "09B8551DB1CEABD14B2FE3670B5D93B060331FBE4901A37DB19C0E882E699E1936ABAB2697B753F5C998BAAEE552"
+	refStream5   = "88F9143CF08EC3F96B4FC3075305D3F8386B15A6410BB96FA38E1C9E386F1C9F342D2FA3933357F1C9183A2E64D3"
+	refPayload   = "101112131415161718191A1B1C1D1E1F"
+	refLastFrame = 0x8005
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad hex %q: %v", s, err)
+	}
+	return b
+}
+
+// refSymbols maps data to symbols with the dibit table of the
+// specification.
+func refSymbols(data []byte) []int8 {
+	dibits := [4]int8{0b00: 1, 0b01: 3, 0b10: -1, 0b11: -3}
+	syms := make([]int8, 0, len(data)*4)
+	for _, b := range data {
+		for shift := 6; shift >= 0; shift -= 2 {
+			syms = append(syms, dibits[b>>shift&3])
+		}
+	}
+	return syms
+}
+
+func refFrame(t *testing.T, sync uint16, frame string) []int8 {
+	t.Helper()
+	return refSymbols(append([]byte{byte(sync >> 8), byte(sync)}, mustHex(t, frame)...))
+}
+
+func refLSFBytes(t *testing.T) [30]byte {
+	var lsf [30]byte
+	copy(lsf[:], mustHex(t, refLSF))
+	return lsf
+}
+
+func TestSyncWordSymbols(t *testing.T) {
+	tests := []struct {
+		sync uint16
+		want []int8
+	}{
+		{SyncLSF, []int8{3, 3, 3, 3, -3, -3, 3, -3}},
+		{SyncStream, []int8{-3, -3, -3, -3, 3, 3, -3, 3}},
+		{SyncPacket, []int8{3, -3, 3, 3, -3, -3, -3, -3}},
+	}
+	for _, tt := range tests {
+		if got := wordSymbols(tt.sync); !slices.Equal(got, tt.want) {
+			t.Errorf("sync %04X: got %v, want %v", tt.sync, got, tt.want)
+		}
+	}
+}
+
+func TestGolayMinimumDistance(t *testing.T) {
+	minWeight := 24
+	for d := uint16(1); d < 1<<12; d++ {
+		minWeight = min(minWeight, bits.OnesCount32(golayEncode(d)))
+	}
+	if minWeight != 8 {
+		t.Fatalf("minimum distance %d, want 8", minWeight)
+	}
+}
+
+func TestPunctureLengths(t *testing.T) {
+	if n := len(convEncode(make([]uint8, 240), puncturePattern1)); n != frameBits {
+		t.Errorf("LSF: %d bits, want %d", n, frameBits)
+	}
+	if n := len(convEncode(make([]uint8, 144), puncturePattern2)); n != frameBits-96 {
+		t.Errorf("stream: %d bits, want %d", n, frameBits-96)
+	}
+}
+
+func TestInterleaveAndDecorrelateAreInvolutions(t *testing.T) {
+	in := make([]uint8, frameBits)
+	for i := range in {
+		in[i] = uint8(i*7+i/3) & 1
+	}
+
+	if got := interleave(interleave(in)); !slices.Equal(got, in) {
+		t.Error("interleave is not its own inverse")
+	}
+
+	got := slices.Clone(in)
+	decorrelate(got)
+	if slices.Equal(got, in) {
+		t.Error("decorrelate did not change the frame")
+	}
+	decorrelate(got)
+	if !slices.Equal(got, in) {
+		t.Error("decorrelate is not its own inverse")
+	}
+}
+
+func TestFrameLengths(t *testing.T) {
+	var lsf [30]byte
+	frames := map[string][]int8{
+		"preamble": Preamble(),
+		"lsf":      EncodeLSFFrame(lsf),
+		"stream":   EncodeStreamFrame(lsf, 0, 0, [16]byte{}),
+		"eot":      EOT(),
+	}
+	for name, syms := range frames {
+		if len(syms) != SymbolsPerFrame {
+			t.Errorf("%s: %d symbols, want %d", name, len(syms), SymbolsPerFrame)
+		}
+	}
+}
+
+func TestEncodeLICHCounter(t *testing.T) {
+	var lsf [30]byte
+	for i := range lsf {
+		lsf[i] = byte(i)
+	}
+	for counter := uint8(0); counter < 6; counter++ {
+		got := bitsToBytes(encodeLICH(lsf, counter))
+		// The data half of the last codeword holds the low nibble of the
+		// fifth chunk byte followed by the counter.
+		last := uint16(got[9])<<4 | uint16(got[10])>>4
+		want := uint16(lsf[counter*5+4]&0x0F)<<8 | uint16(counter)<<5
+		if last != want {
+			t.Errorf("counter %d: last word %03X, want %03X", counter, last, want)
+		}
+	}
+}
+
+func TestEncodeLSFFrameReference(t *testing.T) {
+	if got, want := EncodeLSFFrame(refLSFBytes(t)), refFrame(t, SyncLSF, refLSFFrame); !slices.Equal(got, want) {
+		t.Fatalf("LSF frame\ngot  %v\nwant %v", got, want)
+	}
+}
+
+func TestEncodeStreamFrameReference(t *testing.T) {
+	var payload [16]byte
+	copy(payload[:], mustHex(t, refPayload))
+	tests := []struct {
+		counter  uint8
+		frameNum uint16
+		want     string
+	}{
+		{0, 0, refStream0},
+		{5, refLastFrame, refStream5},
+	}
+	for _, tt := range tests {
+		got := EncodeStreamFrame(refLSFBytes(t), tt.counter, tt.frameNum, payload)
+		if want := refFrame(t, SyncStream, tt.want); !slices.Equal(got, want) {
+			t.Errorf("stream frame %04X\ngot  %v\nwant %v", tt.frameNum, got, want)
+		}
+	}
+}
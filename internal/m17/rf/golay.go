@@ -0,0 +1,52 @@
+package rf
+
+// golayMatrix is the parity generator of the extended Golay(24,12) code
+// used to protect the LICH.
+var golayMatrix = [12]uint16{
+	0x8EB, 0x93E, 0xA97, 0xDC6, 0x367, 0x6CD,
+	0xD99, 0x3DA, 0x7B4, 0xF68, 0x63B, 0xC75,
+}
+
+func golayEncode(data uint16) uint32 {
+	var parity uint16
+	for i := 0; i < 12; i++ {
+		if data&(1<<i) != 0 {
+			parity ^= golayMatrix[i]
+		}
+	}
+	return uint32(data&0xFFF)<<12 | uint32(parity)
+}
+
+// golaySyndromes maps the syndrome of every error pattern of weight three
+// or less to that pattern.
+var golaySyndromes = func() map[uint16]uint32 {
+	table := make(map[uint16]uint32, 2325)
+	add := func(e uint32) {
+		table[golaySyndrome(e)] = e
+	}
+	add(0)
+	for i := 0; i < 24; i++ {
+		add(1 << i)
+		for j := i + 1; j < 24; j++ {
+			add(1<<i | 1<<j)
+			for k := j + 1; k < 24; k++ {
+				add(1<<i | 1<<j | 1<<k)
+			}
+		}
+	}
+	return table
+}()
+
+func golaySyndrome(cw uint32) uint16 {
+	return uint16(golayEncode(uint16(cw>>12))^cw) & 0xFFF
+}
+
+// golayDecode corrects up to three bit errors in cw and returns the 12
+// data bits, or false if the codeword is not correctable.
+func golayDecode(cw uint32) (uint16, bool) {
+	e, ok := golaySyndromes[golaySyndrome(cw)]
+	if !ok {
+		return 0, false
+	}
+	return uint16((cw ^ e) >> 12), true
+}
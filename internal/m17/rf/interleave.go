@@ -0,0 +1,46 @@
+package rf
+
+const frameBits = 368
+
+// interleaveSeq is the quadratic permutation polynomial interleaver
+// (45i + 92i^2) mod 368. It is its own inverse.
+var interleaveSeq = func() [frameBits]uint16 {
+	var seq [frameBits]uint16
+	for i := range seq {
+		seq[i] = uint16((45*i + 92*i*i) % frameBits)
+	}
+	return seq
+}()
+
+func interleave[T any](bits []T) []T {
+	out := make([]T, frameBits)
+	for i := range out {
+		out[i] = bits[interleaveSeq[i]]
+	}
+	return out
+}
+
+var decorrelatorSeq = [frameBits / 8]byte{
+	0xD6, 0xB5, 0xE2, 0x30, 0x82, 0xFF, 0x84, 0x62, 0xBA, 0x4E, 0x96, 0x90,
+	0xD8, 0x98, 0xDD, 0x5D, 0x0C, 0xC8, 0x52, 0x43, 0x91, 0x1D, 0xF8, 0x6E,
+	0x68, 0x2F, 0x35, 0xDA, 0x14, 0xEA, 0xCD, 0x76, 0x19, 0x8D, 0xD5, 0x80,
+	0xD1, 0x33, 0x87, 0x13, 0x57, 0x18, 0x2D, 0x29, 0x78, 0xC3,
+}
+
+// decorrelate XORs the frame with the decorrelator sequence in place.
+// Applying it twice restores the input.
+func decorrelate(bits []uint8) {
+	for i := range bits {
+		bits[i] ^= (decorrelatorSeq[i/8] >> (7 - i%8)) & 1
+	}
+}
+
+// decorrelateSoft is decorrelate for soft bits, where flipping a bit
+// negates it.
+func decorrelateSoft(soft []float64) {
+	for i := range soft {
+		if (decorrelatorSeq[i/8]>>(7-i%8))&1 != 0 {
+			soft[i] = -soft[i]
+		}
+	}
+}
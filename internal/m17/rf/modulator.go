@@ -0,0 +1,145 @@
+package rf
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/kc1awv/m17-webclient/internal/m17"
+)
+
+type SymbolWriter interface {
+	WriteSymbols(syms []int8) error
+}
+
+// SymbolBuffer collects symbols in memory.
+type SymbolBuffer struct {
+	Symbols []int8
+}
+
+func (b *SymbolBuffer) WriteSymbols(syms []int8) error {
+	b.Symbols = append(b.Symbols, syms...)
+	return nil
+}
+
+type symbolStreamWriter struct {
+	w io.Writer
+}
+
+// NewSymbolStreamWriter writes each symbol as a signed byte.
+func NewSymbolStreamWriter(w io.Writer) SymbolWriter {
+	return symbolStreamWriter{w: w}
+}
+
+func (s symbolStreamWriter) WriteSymbols(syms []int8) error {
+	buf := make([]byte, len(syms))
+	for i, sym := range syms {
+		buf[i] = byte(sym)
+	}
+	_, err := s.w.Write(buf)
+	return err
+}
+
+// BasebandWriter shapes symbols into 48 kHz baseband and writes them as a
+// WAV file suitable for an FM modulator.
+type BasebandWriter struct {
+	shaper *Shaper
+	wav    *WAVWriter
+}
+
+func NewBasebandWriter(w io.Writer) (*BasebandWriter, error) {
+	wav, err := NewWAVWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	return &BasebandWriter{shaper: NewShaper(), wav: wav}, nil
+}
+
+func (b *BasebandWriter) WriteSymbols(syms []int8) error {
+	return b.wav.WriteSamples(b.shaper.Shape(syms))
+}
+
+func (b *BasebandWriter) Close() error {
+	if err := b.wav.WriteSamples(b.shaper.Flush()); err != nil {
+		return err
+	}
+	return b.wav.Close()
+}
+
+// Modulator turns M17 IP stream packets, as produced by
+// m17.StreamHandler, into RF frames: preamble and LSF when a stream
+// starts, one stream frame per packet and EOT after the last frame.
+type Modulator struct {
+	out        SymbolWriter
+	active     bool
+	streamID   uint16
+	lsf        [30]byte
+	pendingLSF [30]byte
+	counter    uint8
+}
+
+func NewModulator(out SymbolWriter) *Modulator {
+	return &Modulator{out: out}
+}
+
+func lsdToLSF(lsd [28]byte) [30]byte {
+	var lsf [30]byte
+	copy(lsf[:28], lsd[:])
+	binary.BigEndian.PutUint16(lsf[28:30], m17.CRC16(lsd[:]))
+	return lsf
+}
+
+func (m *Modulator) WritePacket(pkt []byte) error {
+	sp, err := m17.ParseStreamPacket(pkt)
+	if err != nil {
+		return err
+	}
+
+	if m.active && sp.StreamID != m.streamID {
+		if err := m.out.WriteSymbols(EOT()); err != nil {
+			return err
+		}
+		m.active = false
+	}
+
+	lsf := lsdToLSF(sp.LSD)
+	if !m.active {
+		m.active = true
+		m.streamID = sp.StreamID
+		m.lsf = lsf
+		m.pendingLSF = lsf
+		m.counter = 0
+		if err := m.out.WriteSymbols(Preamble()); err != nil {
+			return err
+		}
+		if err := m.out.WriteSymbols(EncodeLSFFrame(lsf)); err != nil {
+			return err
+		}
+	}
+
+	// The LICH carries the LSF in six chunks, so META changes only take
+	// effect at the start of a LICH cycle.
+	m.pendingLSF = lsf
+	if m.counter == 0 {
+		m.lsf = m.pendingLSF
+	}
+
+	if err := m.out.WriteSymbols(EncodeStreamFrame(m.lsf, m.counter, sp.FrameNum, sp.Payload)); err != nil {
+		return err
+	}
+	m.counter = (m.counter + 1) % 6
+
+	if sp.IsLast() {
+		m.active = false
+		return m.out.WriteSymbols(EOT())
+	}
+	return nil
+}
+
+// Close terminates an unfinished transmission with an EOT marker.
+func (m *Modulator) Close() error {
+	if !m.active {
+		return nil
+	}
+	m.active = false
+	return m.out.WriteSymbols(EOT())
+}
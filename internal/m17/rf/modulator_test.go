@@ -0,0 +1,157 @@
+package rf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/kc1awv/m17-webclient/internal/m17"
+)
+
+func buildTestStream(t *testing.T, frames int) [][]byte {
+	t.Helper()
+	lsf, err := m17.BuildLSF("DST", "SRC", m17.LSFType{Stream: true, DataType: m17.DataTypeVoice}, [14]byte{})
+	if err != nil {
+		t.Fatalf("BuildLSF: %v", err)
+	}
+	var pkts [][]byte
+	for i := 0; i < frames; i++ {
+		pkt, err := m17.BuildStreamPacket(0x1234, m17.LSFToLSD(lsf), uint16(i), i == frames-1, [16]byte{byte(i)})
+		if err != nil {
+			t.Fatalf("BuildStreamPacket: %v", err)
+		}
+		pkts = append(pkts, pkt)
+	}
+	return pkts
+}
+
+func TestModulatorFrameSequence(t *testing.T) {
+	var buf SymbolBuffer
+	mod := NewModulator(&buf)
+	for _, pkt := range buildTestStream(t, 8) {
+		if err := mod.WritePacket(pkt); err != nil {
+			t.Fatalf("WritePacket: %v", err)
+		}
+	}
+
+	// preamble, LSF, 8 stream frames, EOT
+	if len(buf.Symbols) != 11*SymbolsPerFrame {
+		t.Fatalf("got %d symbols, want %d", len(buf.Symbols), 11*SymbolsPerFrame)
+	}
+	frame := func(i int) []int8 { return buf.Symbols[i*SymbolsPerFrame : (i+1)*SymbolsPerFrame] }
+
+	if !slices.Equal(frame(0), Preamble()) {
+		t.Error("frame 0 is not the preamble")
+	}
+	if !slices.Equal(frame(1)[:8], wordSymbols(SyncLSF)) {
+		t.Error("frame 1 does not start with the LSF sync word")
+	}
+	for i := 2; i < 10; i++ {
+		if !slices.Equal(frame(i)[:8], wordSymbols(SyncStream)) {
+			t.Errorf("frame %d does not start with the stream sync word", i)
+		}
+	}
+	if !slices.Equal(frame(10), EOT()) {
+		t.Error("last frame is not EOT")
+	}
+	if err := mod.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if len(buf.Symbols) != 11*SymbolsPerFrame {
+		t.Error("Close after last frame emitted another EOT")
+	}
+}
+
+// refStreamPackets returns the reference stream: six frames with the
+// reference LSF and payload, the last one marked last.
+func refStreamPackets(t *testing.T) [][]byte {
+	t.Helper()
+	var lsd [28]byte
+	copy(lsd[:], mustHex(t, refLSF))
+	var payload [16]byte
+	copy(payload[:], mustHex(t, refPayload))
+
+	var pkts [][]byte
+	for fn := uint16(0); fn <= refLastFrame&0x7FFF; fn++ {
+		pkt, err := m17.BuildStreamPacket(0x1234, lsd, fn, fn == refLastFrame&0x7FFF, payload)
+		if err != nil {
+			t.Fatalf("BuildStreamPacket: %v", err)
+		}
+		pkts = append(pkts, pkt)
+	}
+	return pkts
+}
+
+func TestModulatorReference(t *testing.T) {
+	var buf SymbolBuffer
+	mod := NewModulator(&buf)
+	for _, pkt := range refStreamPackets(t) {
+		if err := mod.WritePacket(pkt); err != nil {
+			t.Fatalf("WritePacket: %v", err)
+		}
+	}
+	if len(buf.Symbols) != 9*SymbolsPerFrame {
+		t.Fatalf("got %d symbols, want %d", len(buf.Symbols), 9*SymbolsPerFrame)
+	}
+	frame := func(i int) []int8 { return buf.Symbols[i*SymbolsPerFrame : (i+1)*SymbolsPerFrame] }
+
+	tests := []struct {
+		name  string
+		index int
+		want  []int8
+	}{
+		{"preamble", 0, refSymbols(bytes.Repeat([]byte{0x77}, SymbolsPerFrame/4))},
+		{"LSF", 1, refFrame(t, SyncLSF, refLSFFrame)},
+		{"first stream frame", 2, refFrame(t, SyncStream, refStream0)},
+		{"last stream frame", 7, refFrame(t, SyncStream, refStream5)},
+		{"EOT", 8, refSymbols(bytes.Repeat([]byte{0x55, 0x5D}, SymbolsPerFrame/8))},
+	}
+	for _, tt := range tests {
+		if got := frame(tt.index); !slices.Equal(got, tt.want) {
+			t.Errorf("%s\ngot  %v\nwant %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBasebandWriterWAV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.wav")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	bw, err := NewBasebandWriter(f)
+	if err != nil {
+		t.Fatalf("NewBasebandWriter: %v", err)
+	}
+	mod := NewModulator(bw)
+	for _, pkt := range buildTestStream(t, 2) {
+		if err := mod.WritePacket(pkt); err != nil {
+			t.Fatalf("WritePacket: %v", err)
+		}
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	f.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	wantSamples := 5*SymbolsPerFrame*SamplesPerSymbol + len(rrcTaps)
+	if len(data) != 44+wantSamples*2 {
+		t.Fatalf("file is %d bytes, want %d", len(data), 44+wantSamples*2)
+	}
+	if string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		t.Fatal("missing RIFF/WAVE header")
+	}
+	if rate := binary.LittleEndian.Uint32(data[24:28]); rate != SampleRate {
+		t.Errorf("sample rate %d, want %d", rate, SampleRate)
+	}
+	if size := binary.LittleEndian.Uint32(data[40:44]); size != uint32(wantSamples*2) {
+		t.Errorf("data size %d, want %d", size, wantSamples*2)
+	}
+}
@@ -0,0 +1,350 @@
+package rf
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/kc1awv/m17-webclient/internal/m17"
+)
+
+const (
+	// frameSamples is the spacing of consecutive sync words.
+	frameSamples = SymbolsPerFrame * SamplesPerSymbol
+	// payloadSymbols follow the 8 symbol sync word in every frame.
+	payloadSymbols = SymbolsPerFrame - 8
+
+	// syncThreshold is the normalized sync correlation needed to acquire
+	// a transmission; once locked onto a stream the next sync word only
+	// has to clear lockThreshold at the expected position.
+	syncThreshold = 0.9
+	lockThreshold = 0.6
+	// syncWindow is how far, in samples, a sync peak is searched around a
+	// candidate or the expected position.
+	syncWindow = SamplesPerSymbol / 2
+)
+
+var (
+	lsfSyncSymbols    = wordSymbols(SyncLSF)
+	streamSyncSymbols = wordSymbols(SyncStream)
+)
+
+type syncCandidate struct {
+	at    int
+	kind  uint16
+	score float64
+}
+
+// Receiver recovers M17 stream packets from 48 kHz baseband. It matched
+// filters the samples, searches for LSF and stream sync words, decodes
+// the frames and sends every recovered stream frame to packets as an M17
+// IP stream packet, the same format a reflector delivers. Streams joined
+// after the LSF are picked up once a full LICH cycle has been received.
+type Receiver struct {
+	packets chan<- []byte
+	mf      *rrcFilter
+
+	buf  []float64
+	base int
+	next int
+
+	cand     syncCandidate
+	haveCand bool
+	pending  bool
+	frame    syncCandidate
+	locked   bool
+	expectAt int
+
+	streaming bool
+	streamID  uint16
+	lsf       [30]byte
+	lich      [6][5]byte
+	lichHave  uint8
+}
+
+func NewReceiver(packets chan<- []byte) *Receiver {
+	return &Receiver{packets: packets, mf: newRRCFilter()}
+}
+
+// Run reads baseband from r, either a WAV file or raw 16-bit samples,
+// until it is exhausted.
+func (rx *Receiver) Run(r io.Reader) error {
+	sr, err := NewSampleReader(r)
+	if err != nil {
+		return err
+	}
+	buf := make([]int16, SampleRate/50)
+	for {
+		n, err := sr.ReadSamples(buf)
+		rx.WriteSamples(buf[:n])
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (rx *Receiver) WriteSamples(samples []int16) {
+	for _, s := range samples {
+		rx.buf = append(rx.buf, rx.mf.push(float64(s)))
+	}
+	rx.process()
+	rx.trim()
+}
+
+func (rx *Receiver) at(i int) float64 { return rx.buf[i-rx.base] }
+
+func (rx *Receiver) end() int { return rx.base + len(rx.buf) }
+
+func (rx *Receiver) process() {
+	for {
+		if rx.pending {
+			if rx.end() <= rx.frame.at+payloadSymbols*SamplesPerSymbol {
+				return
+			}
+			rx.pending = false
+			rx.decodeFrame(rx.frame)
+			continue
+		}
+		if rx.next >= rx.end() {
+			return
+		}
+		i := rx.next
+		rx.next++
+		rx.examine(i)
+	}
+}
+
+func (rx *Receiver) trim() {
+	keep := rx.next
+	if rx.pending {
+		keep = min(keep, rx.frame.at)
+	}
+	keep -= 8 * SamplesPerSymbol
+	if drop := keep - rx.base; drop > 4*frameSamples {
+		rx.buf = append(rx.buf[:0], rx.buf[drop:]...)
+		rx.base += drop
+	}
+}
+
+// syncScore is the normalized correlation of the eight symbols ending at
+// sample i with the LSF sync word. The stream sync word is its inverse,
+// so its score is the negation.
+func (rx *Receiver) syncScore(i int) float64 {
+	var corr, energy float64
+	for k, s := range lsfSyncSymbols {
+		x := rx.at(i - (7-k)*SamplesPerSymbol)
+		corr += x * float64(s)
+		energy += x * x
+	}
+	if energy == 0 {
+		return 0
+	}
+	return corr / math.Sqrt(energy*72)
+}
+
+func (rx *Receiver) examine(i int) {
+	if i-7*SamplesPerSymbol < rx.base {
+		return
+	}
+	score := rx.syncScore(i)
+
+	if rx.locked {
+		if i < rx.expectAt-syncWindow {
+			return
+		}
+		if !rx.haveCand || -score > rx.cand.score {
+			rx.cand = syncCandidate{at: i, kind: SyncStream, score: -score}
+			rx.haveCand = true
+		}
+		if i >= rx.expectAt+syncWindow {
+			rx.haveCand = false
+			if rx.cand.score >= lockThreshold {
+				rx.pending = true
+				rx.frame = rx.cand
+			} else {
+				rx.unlock()
+			}
+		}
+		return
+	}
+
+	kind := SyncLSF
+	if score < 0 {
+		kind, score = SyncStream, -score
+	}
+	if score >= syncThreshold && (!rx.haveCand || score > rx.cand.score) {
+		rx.cand = syncCandidate{at: i, kind: kind, score: score}
+		rx.haveCand = true
+	}
+	if rx.haveCand && i-rx.cand.at >= syncWindow {
+		rx.haveCand = false
+		rx.pending = true
+		rx.frame = rx.cand
+	}
+}
+
+func (rx *Receiver) unlock() {
+	rx.locked = false
+	rx.streaming = false
+	rx.lichHave = 0
+}
+
+// frameSoftBits slices the symbols of the frame whose sync word ends at
+// f.at, scales them using the sync word amplitude and converts them to
+// soft bits.
+func (rx *Receiver) frameSoftBits(f syncCandidate) ([]float64, bool) {
+	sync := lsfSyncSymbols
+	if f.kind == SyncStream {
+		sync = streamSyncSymbols
+	}
+	var gain float64
+	for k, s := range sync {
+		gain += rx.at(f.at-(7-k)*SamplesPerSymbol) * float64(s)
+	}
+	gain /= 72
+	if gain <= 0 {
+		return nil, false
+	}
+
+	soft := make([]float64, 0, frameBits)
+	for j := 1; j <= payloadSymbols; j++ {
+		y := rx.at(f.at+j*SamplesPerSymbol) / gain
+		soft = append(soft, clampSoft(-y), clampSoft(math.Abs(y)-2))
+	}
+	decorrelateSoft(soft)
+	return interleave(soft), true
+}
+
+func clampSoft(v float64) float64 {
+	return max(-1, min(1, v))
+}
+
+func (rx *Receiver) decodeFrame(f syncCandidate) {
+	ok := false
+	if soft, valid := rx.frameSoftBits(f); valid {
+		switch f.kind {
+		case SyncLSF:
+			ok = rx.decodeLSF(soft)
+		case SyncStream:
+			ok = rx.decodeStream(soft)
+		}
+	}
+
+	if !ok {
+		// A false sync outside a stream: resume the search right after it.
+		rx.unlock()
+		rx.next = f.at + 1
+		return
+	}
+	rx.next = f.at + payloadSymbols*SamplesPerSymbol + 1
+	if rx.locked {
+		rx.expectAt = f.at + frameSamples
+	}
+}
+
+func (rx *Receiver) decodeLSF(soft []float64) bool {
+	bits := viterbiDecode(depuncture(soft, puncturePattern1, 488))
+	var lsf [30]byte
+	copy(lsf[:], bitsToBytes(bits))
+	if !lsfValid(lsf) {
+		return false
+	}
+	rx.startStream(lsf)
+	return true
+}
+
+func lsfValid(lsf [30]byte) bool {
+	return m17.CRC16(lsf[:28]) == binary.BigEndian.Uint16(lsf[28:30])
+}
+
+func (rx *Receiver) startStream(lsf [30]byte) {
+	var id [2]byte
+	_, _ = rand.Read(id[:])
+	rx.streamID = binary.BigEndian.Uint16(id[:])
+	rx.lsf = lsf
+	rx.streaming = true
+	rx.locked = true
+	rx.lichHave = 0
+}
+
+// decodeLICH returns the LSF chunk and counter carried by the first 96
+// soft bits of a stream frame.
+func decodeLICH(soft []float64) ([5]byte, uint8, bool) {
+	var words [4]uint16
+	for w := range words {
+		var cw uint32
+		for _, v := range soft[w*24 : w*24+24] {
+			cw <<= 1
+			if v > 0 {
+				cw |= 1
+			}
+		}
+		data, ok := golayDecode(cw)
+		if !ok {
+			return [5]byte{}, 0, false
+		}
+		words[w] = data
+	}
+
+	chunk := [5]byte{
+		byte(words[0] >> 4),
+		byte(words[0]<<4) | byte(words[1]>>8),
+		byte(words[1]),
+		byte(words[2] >> 4),
+		byte(words[2]<<4) | byte(words[3]>>8),
+	}
+	counter := byte(words[3]) >> 5
+	return chunk, counter, counter < 6
+}
+
+func (rx *Receiver) decodeStream(soft []float64) bool {
+	chunk, counter, lichOK := decodeLICH(soft[:96])
+	if lichOK {
+		rx.lich[counter] = chunk
+		rx.lichHave |= 1 << counter
+		if rx.lichHave == 0x3F {
+			rx.lichHave = 0
+			var lsf [30]byte
+			for c := range rx.lich {
+				copy(lsf[c*5:], rx.lich[c][:])
+			}
+			if lsfValid(lsf) {
+				if rx.streaming {
+					rx.lsf = lsf
+				} else {
+					rx.startStream(lsf)
+				}
+			}
+		}
+	}
+
+	if !rx.streaming {
+		// Without an LSF, the LICH is the only check that this is a real
+		// frame; keep following it while the LICH decodes.
+		if !lichOK {
+			return false
+		}
+		rx.locked = true
+		return true
+	}
+
+	bits := viterbiDecode(depuncture(soft[96:], puncturePattern2, 296))
+	data := bitsToBytes(bits)
+	frameNum := binary.BigEndian.Uint16(data[0:2])
+	var payload [16]byte
+	copy(payload[:], data[2:18])
+
+	pkt, err := m17.BuildStreamPacket(rx.streamID, m17.LSFToLSD(rx.lsf), frameNum, false, payload)
+	if err == nil {
+		rx.packets <- pkt
+	}
+	if frameNum&0x8000 != 0 {
+		rx.unlock()
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+package rf
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/kc1awv/m17-webclient/internal/m17"
+)
+
+func receiveAll(t *testing.T, feed func(rx *Receiver)) []*m17.StreamPacket {
+	t.Helper()
+	packets := make(chan []byte, 100)
+	feed(NewReceiver(packets))
+	close(packets)
+
+	var out []*m17.StreamPacket
+	for pkt := range packets {
+		sp, err := m17.ParseStreamPacket(pkt)
+		if err != nil {
+			t.Fatalf("ParseStreamPacket: %v", err)
+		}
+		out = append(out, sp)
+	}
+	return out
+}
+
+func TestGolayDecodeCorrectsThreeErrors(t *testing.T) {
+	for _, data := range []uint16{0x000, 0xABC, 0xFFF} {
+		cw := golayEncode(data)
+		for _, e := range []uint32{0, 1, 1<<23 | 1, 1<<5 | 1<<12 | 1<<20} {
+			got, ok := golayDecode(cw ^ e)
+			if !ok || got != data {
+				t.Errorf("data %03X error %06X: got %03X ok=%v", data, e, got, ok)
+			}
+		}
+	}
+}
+
+func TestViterbiRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	in := make([]uint8, 144)
+	for i := range in {
+		in[i] = uint8(r.Intn(2))
+	}
+	coded := convEncode(in, puncturePattern2)
+	soft := make([]float64, len(coded))
+	for i, b := range coded {
+		soft[i] = float64(b)*2 - 1
+	}
+	// flip a few bits
+	soft[10], soft[100], soft[200] = -soft[10], -soft[100], -soft[200]
+
+	got := viterbiDecode(depuncture(soft, puncturePattern2, 296))
+	if !bytes.Equal(got, in) {
+		t.Fatal("decoded bits differ from input")
+	}
+}
+
+func TestReceiverLoopback(t *testing.T) {
+	sent := buildTestStream(t, 10)
+
+	var wav bytes.Buffer
+	bw, err := NewBasebandWriter(&wav)
+	if err != nil {
+		t.Fatalf("NewBasebandWriter: %v", err)
+	}
+	mod := NewModulator(bw)
+	for _, pkt := range sent {
+		if err := mod.WritePacket(pkt); err != nil {
+			t.Fatalf("WritePacket: %v", err)
+		}
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	got := receiveAll(t, func(rx *Receiver) {
+		if err := rx.Run(&wav); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+	})
+	if len(got) != len(sent) {
+		t.Fatalf("got %d packets, want %d", len(got), len(sent))
+	}
+	for i, sp := range got {
+		want, _ := m17.ParseStreamPacket(sent[i])
+		if sp.FrameNum != want.FrameNum || sp.Payload != want.Payload || sp.LSD != want.LSD {
+			t.Errorf("packet %d: got fn %04X payload %X, want fn %04X payload %X", i, sp.FrameNum, sp.Payload, want.FrameNum, want.Payload)
+		}
+		if sp.StreamID != got[0].StreamID {
+			t.Errorf("packet %d: stream ID changed", i)
+		}
+	}
+}
+
+func TestReceiverLateEntry(t *testing.T) {
+	var syms SymbolBuffer
+	mod := NewModulator(&syms)
+	for _, pkt := range buildTestStream(t, 12) {
+		if err := mod.WritePacket(pkt); err != nil {
+			t.Fatalf("WritePacket: %v", err)
+		}
+	}
+
+	// Drop the preamble and LSF, and add noise to the rest.
+	r := rand.New(rand.NewSource(2))
+	shaper := NewShaper()
+	samples := append(shaper.Shape(syms.Symbols[2*SymbolsPerFrame:]), shaper.Flush()...)
+	for i := range samples {
+		samples[i] += int16(r.NormFloat64() * 1500)
+	}
+
+	got := receiveAll(t, func(rx *Receiver) { rx.WriteSamples(samples) })
+
+	// The first full LICH cycle ends with frame 5.
+	if len(got) != 7 {
+		t.Fatalf("got %d packets, want 7", len(got))
+	}
+	if fn := got[0].FrameNum; fn != 5 {
+		t.Errorf("first frame %d, want 5", fn)
+	}
+	if !got[len(got)-1].IsLast() {
+		t.Error("last packet is not marked last")
+	}
+}
+
+func TestReceiverReference(t *testing.T) {
+	// Baseband built from the reference frames rather than the encoder:
+	// preamble, LSF, the first and last stream frames, EOT.
+	var syms []int8
+	syms = append(syms, refSymbols(bytes.Repeat([]byte{0x77}, SymbolsPerFrame/4))...)
+	syms = append(syms, refFrame(t, SyncLSF, refLSFFrame)...)
+	syms = append(syms, refFrame(t, SyncStream, refStream0)...)
+	syms = append(syms, refFrame(t, SyncStream, refStream5)...)
+	syms = append(syms, refSymbols(bytes.Repeat([]byte{0x55, 0x5D}, SymbolsPerFrame/8))...)
+
+	r := rand.New(rand.NewSource(3))
+	shaper := NewShaper()
+	samples := append(shaper.Shape(syms), shaper.Flush()...)
+	for i := range samples {
+		samples[i] += int16(r.NormFloat64() * 1500)
+	}
+
+	got := receiveAll(t, func(rx *Receiver) { rx.WriteSamples(samples) })
+	if len(got) != 2 {
+		t.Fatalf("got %d packets, want 2", len(got))
+	}
+	lsf := refLSFBytes(t)
+	payload := mustHex(t, refPayload)
+	for i, fn := range []uint16{0, refLastFrame} {
+		sp := got[i]
+		if sp.FrameNum != fn || !bytes.Equal(sp.Payload[:], payload) || !bytes.Equal(sp.LSD[:], lsf[:28]) {
+			t.Errorf("packet %d: got fn %04X payload %X LSD %X", i, sp.FrameNum, sp.Payload, sp.LSD)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package rf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// WAVWriter writes 16-bit mono PCM at SampleRate. When the destination is
+// an io.WriteSeeker the header sizes are fixed up on Close; otherwise they
+// are left at their maximum so the output can be streamed.
+type WAVWriter struct {
+	w       io.Writer
+	samples uint32
+}
+
+func NewWAVWriter(w io.Writer) (*WAVWriter, error) {
+	ww := &WAVWriter{w: w}
+	if err := ww.writeHeader(0xFFFFFFFF - 36); err != nil {
+		return nil, err
+	}
+	return ww, nil
+}
+
+func (ww *WAVWriter) writeHeader(dataSize uint32) error {
+	var hdr [44]byte
+	copy(hdr[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(hdr[4:8], 36+dataSize)
+	copy(hdr[8:12], "WAVE")
+	copy(hdr[12:16], "fmt ")
+	binary.LittleEndian.PutUint32(hdr[16:20], 16)
+	binary.LittleEndian.PutUint16(hdr[20:22], 1)
+	binary.LittleEndian.PutUint16(hdr[22:24], 1)
+	binary.LittleEndian.PutUint32(hdr[24:28], SampleRate)
+	binary.LittleEndian.PutUint32(hdr[28:32], SampleRate*2)
+	binary.LittleEndian.PutUint16(hdr[32:34], 2)
+	binary.LittleEndian.PutUint16(hdr[34:36], 16)
+	copy(hdr[36:40], "data")
+	binary.LittleEndian.PutUint32(hdr[40:44], dataSize)
+	_, err := ww.w.Write(hdr[:])
+	return err
+}
+
+func (ww *WAVWriter) WriteSamples(samples []int16) error {
+	buf := make([]byte, len(samples)*2)
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(buf[i*2:], uint16(s))
+	}
+	if _, err := ww.w.Write(buf); err != nil {
+		return err
+	}
+	ww.samples += uint32(len(samples))
+	return nil
+}
+
+func (ww *WAVWriter) Close() error {
+	ws, ok := ww.w.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+	if _, err := ws.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := ww.writeHeader(ww.samples * 2); err != nil {
+		return err
+	}
+	_, err := ws.Seek(0, io.SeekEnd)
+	return err
+}
+
+// SampleReader reads 16-bit mono baseband at SampleRate, either from a WAV
+// file or as raw little-endian samples, e.g. piped from rtl_fm.
+type SampleReader struct {
+	r *bufio.Reader
+}
+
+func NewSampleReader(r io.Reader) (*SampleReader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	sr := &SampleReader{r: br}
+	if string(magic) == "RIFF" {
+		if err := sr.readWAVHeader(); err != nil {
+			return nil, err
+		}
+	}
+	return sr, nil
+}
+
+func (sr *SampleReader) readWAVHeader() error {
+	var riff [12]byte
+	if _, err := io.ReadFull(sr.r, riff[:]); err != nil {
+		return fmt.Errorf("read WAV header: %w", err)
+	}
+	if string(riff[8:12]) != "WAVE" {
+		return fmt.Errorf("not a WAVE file")
+	}
+
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(sr.r, chunk[:]); err != nil {
+			return fmt.Errorf("read WAV chunk: %w", err)
+		}
+		size := binary.LittleEndian.Uint32(chunk[4:8])
+
+		switch string(chunk[0:4]) {
+		case "data":
+			return nil
+		case "fmt ":
+			if size < 16 {
+				return fmt.Errorf("invalid fmt chunk")
+			}
+			fmtChunk := make([]byte, size+size%2)
+			if _, err := io.ReadFull(sr.r, fmtChunk); err != nil {
+				return fmt.Errorf("read fmt chunk: %w", err)
+			}
+			format := binary.LittleEndian.Uint16(fmtChunk[0:2])
+			channels := binary.LittleEndian.Uint16(fmtChunk[2:4])
+			rate := binary.LittleEndian.Uint32(fmtChunk[4:8])
+			bitsPerSample := binary.LittleEndian.Uint16(fmtChunk[14:16])
+			if format != 1 || channels != 1 || rate != SampleRate || bitsPerSample != 16 {
+				return fmt.Errorf("unsupported WAV format: want 16-bit mono PCM at %d Hz", SampleRate)
+			}
+		default:
+			if _, err := sr.r.Discard(int(size + size%2)); err != nil {
+				return fmt.Errorf("skip WAV chunk: %w", err)
+			}
+		}
+	}
+}
+
+// ReadSamples fills buf and returns the number of samples read. It returns
+// io.EOF once the input is exhausted.
+func (sr *SampleReader) ReadSamples(buf []int16) (int, error) {
+	raw := make([]byte, len(buf)*2)
+	n, err := io.ReadFull(sr.r, raw)
+	n /= 2
+	for i := 0; i < n; i++ {
+		buf[i] = int16(binary.LittleEndian.Uint16(raw[i*2:]))
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+	if n == 0 && err == nil {
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,200 @@
+package m17
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Signed streams end with four frames carrying a 64-byte ECDSA secp256r1
+// signature (r || s) over the stream digest, numbered 0x7FFC-0x7FFF.
+const (
+	SignatureFrames     = 4
+	signatureFrameStart = 0x7FFC
+)
+
+func IsSignatureFrame(frameNum uint16) bool {
+	return frameNum&0x7FFF >= signatureFrameStart
+}
+
+// StreamDigest accumulates the payloads of a stream: each payload is XORed
+// in and the digest is then rotated left by one byte.
+type StreamDigest [16]byte
+
+func (d *StreamDigest) Add(payload [16]byte) {
+	for i := range d {
+		d[i] ^= payload[i]
+	}
+	first := d[0]
+	copy(d[:], d[1:])
+	d[15] = first
+}
+
+func SignDigest(priv *ecdsa.PrivateKey, d StreamDigest) ([64]byte, error) {
+	var sig [64]byte
+	r, s, err := ecdsa.Sign(rand.Reader, priv, d[:])
+	if err != nil {
+		return sig, err
+	}
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return sig, nil
+}
+
+func VerifyDigest(pub *ecdsa.PublicKey, d StreamDigest, sig [64]byte) bool {
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	return ecdsa.Verify(pub, d[:], r, s)
+}
+
+// StreamVerifier collects the digest and signature of an incoming signed
+// stream.
+type StreamVerifier struct {
+	digest StreamDigest
+	sig    [64]byte
+	have   uint8
+}
+
+func (v *StreamVerifier) Reset() {
+	*v = StreamVerifier{}
+}
+
+func (v *StreamVerifier) Add(pkt *StreamPacket) {
+	fn := pkt.FrameNum & 0x7FFF
+	if !IsSignatureFrame(fn) {
+		v.digest.Add(pkt.Payload)
+		return
+	}
+	i := fn - signatureFrameStart
+	copy(v.sig[i*16:], pkt.Payload[:])
+	v.have |= 1 << i
+}
+
+// Verify checks the collected signature against pub. It returns false if
+// any signature frame is missing.
+func (v *StreamVerifier) Verify(pub *ecdsa.PublicKey) bool {
+	return v.have == 1<<SignatureFrames-1 && VerifyDigest(pub, v.digest, v.sig)
+}
+
+// ErrSigningToken is returned by SigningKey when the token does not grant
+// use of the key.
+var ErrSigningToken = errors.New("invalid signing token")
+
+// KeyDir is a directory of PEM encoded secp256r1 keys named after the
+// callsign they belong to, e.g. N0CALL.pem.
+type KeyDir string
+
+func (d KeyDir) path(callsign string) (string, error) {
+	return d.file(callsign, ".pem")
+}
+
+func (d KeyDir) file(callsign, ext string) (string, error) {
+	if d == "" {
+		return "", os.ErrNotExist
+	}
+	callsign = strings.ToUpper(strings.TrimSpace(callsign))
+	if callsign == "" || strings.ContainsAny(callsign, `/\`) {
+		return "", fmt.Errorf("invalid callsign for key lookup: %q", callsign)
+	}
+	return filepath.Join(string(d), callsign+ext), nil
+}
+
+func (d KeyDir) readPEM(callsign string) (*pem.Block, error) {
+	path, err := d.path(callsign)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	return block, nil
+}
+
+// PrivateKey loads the signing key for callsign. It accepts SEC 1
+// ("EC PRIVATE KEY") and PKCS #8 ("PRIVATE KEY") encodings. The error
+// satisfies os.IsNotExist when there is no key for the callsign.
+func (d KeyDir) PrivateKey(callsign string) (*ecdsa.PrivateKey, error) {
+	block, err := d.readPEM(callsign)
+	if err != nil {
+		return nil, err
+	}
+
+	var key any
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse private key for %s: %w", callsign, err)
+	}
+	priv, ok := key.(*ecdsa.PrivateKey)
+	if !ok || priv.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("private key for %s is not secp256r1", callsign)
+	}
+	return priv, nil
+}
+
+// SigningKey loads the signing key for callsign on behalf of a client
+// holding token. The hex SHA-256 of the token is kept next to the key as
+// N0CALL.token, so a key without one is never handed out. The callsign
+// alone proves nothing; it is whatever the client claims to be.
+func (d KeyDir) SigningKey(callsign, token string) (*ecdsa.PrivateKey, error) {
+	path, err := d.file(callsign, ".token")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrSigningToken
+		}
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrSigningToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	want, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(want) != sha256.Size {
+		return nil, fmt.Errorf("%s: not a hex SHA-256 digest", path)
+	}
+	got := sha256.Sum256([]byte(token))
+	if token == "" || subtle.ConstantTimeCompare(got[:], want) != 1 {
+		return nil, ErrSigningToken
+	}
+	return d.PrivateKey(callsign)
+}
+
+// PublicKey loads the PKIX ("PUBLIC KEY") encoded key for callsign.
+func (d KeyDir) PublicKey(callsign string) (*ecdsa.PublicKey, error) {
+	block, err := d.readPEM(callsign)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key for %s: %w", callsign, err)
+	}
+	pub, ok := key.(*ecdsa.PublicKey)
+	if !ok || pub.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("public key for %s is not secp256r1", callsign)
+	}
+	return pub, nil
+}
@@ -0,0 +1,121 @@
+package m17
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStreamDigestRotates(t *testing.T) {
+	var d StreamDigest
+	d.Add([16]byte{0x01})
+	if d != (StreamDigest{15: 0x01}) {
+		t.Fatalf("unexpected digest after one frame: %X", d)
+	}
+	d.Add([16]byte{0x02})
+	if d != (StreamDigest{14: 0x01, 15: 0x02}) {
+		t.Fatalf("unexpected digest after two frames: %X", d)
+	}
+}
+
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestKeyDir(t *testing.T) {
+	dir := t.TempDir()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	sec1, _ := x509.MarshalECPrivateKey(priv)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(priv)
+	pkix, _ := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	writePEM(t, filepath.Join(dir, "N0CALL.pem"), "EC PRIVATE KEY", sec1)
+	writePEM(t, filepath.Join(dir, "N1CALL.pem"), "PRIVATE KEY", pkcs8)
+	writePEM(t, filepath.Join(dir, "N2CALL.pem"), "PUBLIC KEY", pkix)
+
+	keys := KeyDir(dir)
+	for _, cs := range []string{"n0call", "N1CALL"} {
+		got, err := keys.PrivateKey(cs)
+		if err != nil {
+			t.Fatalf("PrivateKey(%s): %v", cs, err)
+		}
+		if !got.Equal(priv) {
+			t.Fatalf("PrivateKey(%s) returned a different key", cs)
+		}
+	}
+	pub, err := keys.PublicKey("N2CALL")
+	if err != nil {
+		t.Fatalf("PublicKey: %v", err)
+	}
+
+	var d StreamDigest
+	d.Add([16]byte{1, 2, 3})
+	sig, err := SignDigest(priv, d)
+	if err != nil {
+		t.Fatalf("SignDigest: %v", err)
+	}
+	if !VerifyDigest(pub, d, sig) {
+		t.Fatal("signature did not verify")
+	}
+	d.Add([16]byte{4})
+	if VerifyDigest(pub, d, sig) {
+		t.Fatal("signature verified against a different digest")
+	}
+
+	if _, err := keys.PublicKey("N9CALL"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist error, got %v", err)
+	}
+	if _, err := KeyDir("").PrivateKey("N0CALL"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist error for unset dir, got %v", err)
+	}
+	if _, err := keys.PrivateKey("../N0CALL"); err == nil || errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected invalid callsign error, got %v", err)
+	}
+}
+
+func TestKeyDirSigningKeyNeedsToken(t *testing.T) {
+	dir := t.TempDir()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	sec1, _ := x509.MarshalECPrivateKey(priv)
+	writePEM(t, filepath.Join(dir, "N0CALL.pem"), "EC PRIVATE KEY", sec1)
+	writePEM(t, filepath.Join(dir, "N1CALL.pem"), "EC PRIVATE KEY", sec1)
+	sum := sha256.Sum256([]byte("secret"))
+	if err := os.WriteFile(filepath.Join(dir, "N0CALL.token"), []byte(hex.EncodeToString(sum[:])+"\n"), 0o600); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+
+	keys := KeyDir(dir)
+	got, err := keys.SigningKey("n0call", "secret")
+	if err != nil || !got.Equal(priv) {
+		t.Fatalf("SigningKey with the right token = %v, %v", got, err)
+	}
+	for _, tc := range []struct{ callsign, token string }{
+		{"N0CALL", "wrong"},
+		{"N0CALL", ""},
+		{"N1CALL", "secret"}, // key without a token file
+		{"N9CALL", "secret"},
+	} {
+		if _, err := keys.SigningKey(tc.callsign, tc.token); !errors.Is(err, ErrSigningToken) {
+			t.Fatalf("SigningKey(%s, %q) error = %v; want ErrSigningToken", tc.callsign, tc.token, err)
+		}
+	}
+	if _, err := KeyDir("").SigningKey("N0CALL", "secret"); !errors.Is(err, ErrSigningToken) {
+		t.Fatalf("SigningKey with unset dir error = %v; want ErrSigningToken", err)
+	}
+}
@@ -19,11 +19,11 @@ func (sp *StreamPacket) IsLast() bool {
 type LSF struct {
 	Source      string
 	Destination string
-	Type        uint16
+	Type        LSFType
 	Meta        [14]byte
 }
 
-func BuildLSF(dst, src string, meta [14]byte) ([30]byte, error) {
+func BuildLSF(dst, src string, typ LSFType, meta [14]byte) ([30]byte, error) {
 	var lsf [30]byte
 
 	dstEnc, err := EncodeCallsign(dst)
@@ -38,7 +38,7 @@ func BuildLSF(dst, src string, meta [14]byte) ([30]byte, error) {
 	copy(lsf[0:6], dstEnc[:])
 	copy(lsf[6:12], srcEnc[:])
 
-	binary.BigEndian.PutUint16(lsf[12:14], 0x0005)
+	binary.BigEndian.PutUint16(lsf[12:14], typ.Encode())
 
 	copy(lsf[14:28], meta[:])
 
@@ -69,7 +69,7 @@ func ParseLSF(data []byte) (*LSF, error) {
 	copy(srcEnc[:], data[6:12])
 	srcCall := DecodeCallsign(srcEnc[:])
 
-	typ := binary.BigEndian.Uint16(data[12:14])
+	typ := DecodeLSFType(binary.BigEndian.Uint16(data[12:14]))
 
 	var meta [14]byte
 	copy(meta[:], data[14:28])
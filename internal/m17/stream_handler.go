@@ -1,24 +1,118 @@
 package m17
 
 import (
+	"crypto/ecdsa"
 	"crypto/rand"
 	"encoding/binary"
 	"fmt"
 	"net"
-	"strings"
+	"sync"
+	"time"
 
 	"github.com/kc1awv/m17-webclient/internal/audio"
 )
 
+// maxRxDecoders bounds how many incoming streams keep Codec2 decoder and
+// cipher state at once; the least recently used is dropped beyond that.
+const maxRxDecoders = 4
+
+type rxDecoder struct {
+	codec    *Codec2
+	cipher   *streamCipher
+	lastUsed time.Time
+}
+
+// metaRotateFrames is how many frames each META block is held in the LSD
+// before moving on to the next one, matching one full LICH cycle on RF.
+const metaRotateFrames = 6
+
+// MaxTxData bounds the data waiting to be sent in voice+data streams, about
+// five seconds of frames.
+const MaxTxData = 8 * 128
+
+type StreamMode uint8
+
+const (
+	// StreamModeVoice carries two Codec2 3200 frames per stream frame.
+	StreamModeVoice StreamMode = iota
+	// StreamModeVoiceData carries one Codec2 1600 frame and 8 bytes of
+	// data per stream frame. The data comes from QueueData; frames with
+	// nothing queued carry zeros.
+	StreamModeVoiceData
+)
+
+func ParseStreamMode(s string) (StreamMode, error) {
+	switch s {
+	case "", "3200":
+		return StreamModeVoice, nil
+	case "1600":
+		return StreamModeVoiceData, nil
+	default:
+		return 0, fmt.Errorf("unknown stream mode: %s", s)
+	}
+}
+
+func (m StreamMode) String() string {
+	if m == StreamModeVoiceData {
+		return "1600"
+	}
+	return "3200"
+}
+
+func (m StreamMode) codec2Mode() int {
+	if m == StreamModeVoiceData {
+		return MODE_1600
+	}
+	return MODE_3200
+}
+
+func (m StreamMode) dataType() DataType {
+	if m == StreamModeVoiceData {
+		return DataTypeVoiceData
+	}
+	return DataTypeVoice
+}
+
+type metaBlock struct {
+	subtype uint8
+	meta    [14]byte
+}
+
 type StreamHandler struct {
+	// connMu guards the destination, which is replaced when the reflector
+	// client reconnects.
+	connMu     sync.Mutex
 	udpConn    *net.UDPConn
 	reflector  *net.UDPAddr
-	codec2Inst *Codec2
+	txCodec    *Codec2
+	mode       StreamMode
+	txData     []byte
 	streamID   uint16
+	src        string
+	dst        string
+	lsfType    LSFType
+	meta       [14]byte
 	lsd        [28]byte
+	position   *metaBlock
+	textBlocks []metaBlock
+	metaBlocks []metaBlock
+	metaIndex  int
 	frameNum   uint16
 	pcmBuffer  []int16
 	muBuf      []byte
+	tap        func(pkt []byte)
+
+	key      *Key
+	txCipher *streamCipher
+
+	// rxMu guards the receive side, which runs on the reflector goroutine
+	// while keys are changed from the WebSocket one.
+	rxMu       sync.Mutex
+	rxKey      *Key
+	rxDecoders map[uint16]*rxDecoder
+
+	signer *ecdsa.PrivateKey
+	digest StreamDigest
 }
 
 func generateStreamID() (uint16, error) {
@@ -29,19 +123,31 @@ func generateStreamID() (uint16, error) {
 	return id, nil
 }
 
-func NewStreamHandler(conn *net.UDPConn, reflectorAddr *net.UDPAddr, src, dst string) (*StreamHandler, error) {
-	if len(dst) > 9 || strings.Contains(dst, ":") {
+func NewStreamHandler(conn *net.UDPConn, reflectorAddr *net.UDPAddr, src, dst string, can uint8, mode StreamMode) (*StreamHandler, error) {
+	if addr, err := ParseAddress(dst); err != nil || addr == AddressInvalid {
 		dst = src
 	}
+	if can > MaxCAN {
+		return nil, fmt.Errorf("invalid CAN %d: max %d", can, MaxCAN)
+	}
 
-	meta := [14]byte{}
-	lsf, err := BuildLSF(dst, src, meta)
-	if err != nil {
-		return nil, fmt.Errorf("BuildLSF failed: %w", err)
+	sh := &StreamHandler{
+		udpConn:    conn,
+		reflector:  reflectorAddr,
+		src:        src,
+		dst:        dst,
+		mode:       mode,
+		lsfType:    LSFType{Stream: true, DataType: mode.dataType(), CAN: can},
+		rxDecoders: make(map[uint16]*rxDecoder),
+		frameNum:   0,
+		pcmBuffer:  make([]int16, 0, 320),
+		muBuf:      make([]byte, 0, 320),
+	}
+	if err := sh.rebuildLSD(); err != nil {
+		return nil, err
 	}
-	lsd := LSFToLSD(lsf)
 
-	c2, err := New(MODE_3200)
+	c2, err := New(mode.codec2Mode())
 	if err != nil {
 		return nil, fmt.Errorf("Codec2 init failed: %w", err)
 	}
@@ -51,16 +157,157 @@ func NewStreamHandler(conn *net.UDPConn, reflectorAddr *net.UDPAddr, src, dst st
 		return nil, fmt.Errorf("failed to generate stream ID: %w", err)
 	}
 
-	return &StreamHandler{
-		udpConn:    conn,
-		reflector:  reflectorAddr,
-		codec2Inst: c2,
-		streamID:   sid,
-		lsd:        lsd,
-		frameNum:   0,
-		pcmBuffer:  make([]int16, 0, 320),
-		muBuf:      make([]byte, 0, 320),
-	}, nil
+	sh.txCodec = c2
+	sh.streamID = sid
+	return sh, nil
+}
+
+func (sh *StreamHandler) rebuildLSD() error {
+	lsf, err := BuildLSF(sh.dst, sh.src, sh.lsfType, sh.meta)
+	if err != nil {
+		return fmt.Errorf("BuildLSF failed: %w", err)
+	}
+	sh.lsd = LSFToLSD(lsf)
+	return nil
+}
+
+func (sh *StreamHandler) setMeta(block metaBlock) error {
+	if sh.key != nil {
+		// META carries the nonce while encrypting.
+		return nil
+	}
+	sh.lsfType.EncryptionSubtype = block.subtype
+	sh.meta = block.meta
+	return sh.rebuildLSD()
+}
+
+func (sh *StreamHandler) updateMetaBlocks() error {
+	blocks := make([]metaBlock, 0, 1+len(sh.textBlocks))
+	if sh.position != nil {
+		blocks = append(blocks, *sh.position)
+	}
+	blocks = append(blocks, sh.textBlocks...)
+	sh.metaBlocks = blocks
+	sh.metaIndex = 0
+	if len(blocks) == 0 {
+		return sh.setMeta(metaBlock{subtype: MetaText})
+	}
+	return sh.setMeta(blocks[0])
+}
+
+func (sh *StreamHandler) rotateMeta() error {
+	if len(sh.metaBlocks) < 2 {
+		return nil
+	}
+	sh.metaIndex = (sh.metaIndex + 1) % len(sh.metaBlocks)
+	return sh.setMeta(sh.metaBlocks[sh.metaIndex])
+}
+
+// SetPosition embeds a GNSS position in the META field of subsequent
+// frames. A nil position removes it.
+func (sh *StreamHandler) SetPosition(g *GNSS) error {
+	if g == nil {
+		sh.position = nil
+		return sh.updateMetaBlocks()
+	}
+	meta, err := EncodeGNSS(*g)
+	if err != nil {
+		return err
+	}
+	sh.position = &metaBlock{subtype: MetaGNSS, meta: meta}
+	return sh.updateMetaBlocks()
+}
+
+// SetText rotates a status text through the META field of subsequent
+// frames, alongside any position. An empty text removes it.
+func (sh *StreamHandler) SetText(text string) error {
+	encoded, err := EncodeTextBlocks(text)
+	if err != nil {
+		return err
+	}
+	blocks := make([]metaBlock, len(encoded))
+	for i, meta := range encoded {
+		blocks[i] = metaBlock{subtype: MetaText, meta: meta}
+	}
+	sh.textBlocks = blocks
+	return sh.updateMetaBlocks()
+}
+
+// SetKey encrypts subsequent streams with k and decrypts incoming streams
+// that use the same encryption type and key length. A nil key turns
+// encryption off. Position and text META are not sent while encrypting.
+func (sh *StreamHandler) SetKey(k *Key) error {
+	sh.rxMu.Lock()
+	sh.rxKey = k
+	for _, d := range sh.rxDecoders {
+		d.cipher = nil
+	}
+	sh.rxMu.Unlock()
+
+	sh.key = k
+	sh.txCipher = newStreamCipher(k)
+	if k == nil {
+		sh.lsfType.Encryption = EncryptionNone
+		sh.meta = [14]byte{}
+		return sh.updateMetaBlocks()
+	}
+	sh.lsfType.Encryption = k.Type
+	sh.lsfType.EncryptionSubtype = k.Subtype
+	return sh.newNonce()
+}
+
+func (sh *StreamHandler) newNonce() error {
+	sh.meta = [14]byte{}
+	if sh.key.Type == EncryptionAES {
+		if _, err := rand.Read(sh.meta[:]); err != nil {
+			return fmt.Errorf("failed to generate nonce: %w", err)
+		}
+	}
+	return sh.rebuildLSD()
+}
+
+// CanDecrypt reports whether incoming streams of type t can be played.
+func (sh *StreamHandler) CanDecrypt(t LSFType) bool {
+	if t.Encryption == EncryptionNone {
+		return true
+	}
+	sh.rxMu.Lock()
+	defer sh.rxMu.Unlock()
+	return sh.rxKey.Matches(t)
+}
+
+// Decrypt decrypts the payload of an incoming stream packet in place. It
+// returns ErrNoKey if the stream is encrypted and no matching key is set.
+func (sh *StreamHandler) Decrypt(pkt *StreamPacket, lsf *LSF) error {
+	if lsf.Type.Encryption == EncryptionNone {
+		return nil
+	}
+	sh.rxMu.Lock()
+	defer sh.rxMu.Unlock()
+	if !sh.rxKey.Matches(lsf.Type) {
+		return ErrNoKey
+	}
+	if sh.rxDecoders == nil {
+		return fmt.Errorf("stream handler closed")
+	}
+	d := sh.rxStream(pkt.StreamID)
+	if d.cipher == nil {
+		d.cipher = newStreamCipher(sh.rxKey)
+	}
+	d.cipher.apply(&pkt.Payload, lsf.Meta, pkt.FrameNum)
+	return nil
+}
+
+// SetSigningKey signs subsequent streams with priv. A nil key sends
+// unsigned streams.
+func (sh *StreamHandler) SetSigningKey(priv *ecdsa.PrivateKey) error {
+	sh.signer = priv
+	sh.lsfType.Signed = priv != nil
+	return sh.rebuildLSD()
+}
+
+func (sh *StreamHandler) Signed() bool {
+	return sh.signer != nil
 }
 
 func (sh *StreamHandler) StartNewStream() error {
@@ -71,15 +318,51 @@ func (sh *StreamHandler) StartNewStream() error {
 	sh.streamID = sid
 	sh.frameNum = 0
 	sh.pcmBuffer = sh.pcmBuffer[:0]
+	sh.digest = StreamDigest{}
+	if sh.key != nil {
+		return sh.newNonce()
+	}
+	if len(sh.metaBlocks) > 0 && sh.metaIndex != 0 {
+		sh.metaIndex = 0
+		return sh.setMeta(sh.metaBlocks[0])
+	}
 	return nil
 }
 
+// QueueData queues data for the data half of transmitted voice+data
+// frames. Each call is zero padded to whole frames, so it starts in a frame
+// of its own. It returns the number of bytes waiting to be sent.
+func (sh *StreamHandler) QueueData(data []byte) (int, error) {
+	if sh.mode != StreamModeVoiceData {
+		return len(sh.txData), fmt.Errorf("data needs the %s stream mode", StreamModeVoiceData)
+	}
+	padded := (len(data) + 7) / 8 * 8
+	if len(sh.txData)+padded > MaxTxData {
+		return len(sh.txData), fmt.Errorf("data queue full: max %d bytes", MaxTxData)
+	}
+	sh.txData = append(sh.txData, data...)
+	sh.txData = append(sh.txData, make([]byte, padded-len(data))...)
+	return len(sh.txData), nil
+}
+
 func (sh *StreamHandler) buildPayload(pcm []int16) ([16]byte, error) {
-	part1, err := sh.codec2Inst.Encode(pcm[:160])
+	if sh.mode == StreamModeVoiceData {
+		voice, err := sh.txCodec.Encode(pcm)
+		if err != nil {
+			return [16]byte{}, err
+		}
+		var payload [16]byte
+		copy(payload[0:8], voice)
+		n := copy(payload[8:16], sh.txData)
+		sh.txData = sh.txData[n:]
+		return payload, nil
+	}
+
+	part1, err := sh.txCodec.Encode(pcm[:160])
 	if err != nil {
 		return [16]byte{}, err
 	}
-	part2, err := sh.codec2Inst.Encode(pcm[160:])
+	part2, err := sh.txCodec.Encode(pcm[160:])
 	if err != nil {
 		return [16]byte{}, err
 	}
@@ -92,24 +375,19 @@ func (sh *StreamHandler) buildPayload(pcm []int16) ([16]byte, error) {
 func (sh *StreamHandler) SendPCMFrame(pcm []int16, isLast bool) error {
 	sh.pcmBuffer = append(sh.pcmBuffer, pcm...)
 
+	// In a signed stream the signature frames end the stream.
+	lastVoice := isLast && sh.signer == nil
+
 	for len(sh.pcmBuffer) >= 320 {
-		markLast := isLast && len(sh.pcmBuffer) == 320
+		markLast := lastVoice && len(sh.pcmBuffer) == 320
 
 		payload, err := sh.buildPayload(sh.pcmBuffer[:320])
 		if err != nil {
 			return err
 		}
-
-		pkt, err := BuildStreamPacket(sh.streamID, sh.lsd, sh.frameNum, markLast, payload)
-		if err != nil {
+		if err := sh.sendFrame(payload, markLast); err != nil {
 			return err
 		}
-
-		if _, err := sh.udpConn.WriteToUDP(pkt, sh.reflector); err != nil {
-			return err
-		}
-
-		sh.frameNum++
 		sh.pcmBuffer = sh.pcmBuffer[320:]
 	}
 
@@ -121,42 +399,125 @@ func (sh *StreamHandler) SendPCMFrame(pcm []int16, isLast bool) error {
 		if err != nil {
 			return err
 		}
+		if err := sh.sendFrame(payload, lastVoice); err != nil {
+			return err
+		}
+		sh.pcmBuffer = sh.pcmBuffer[:0]
+	}
+
+	if isLast && sh.signer != nil {
+		return sh.sendSignature()
+	}
+	return nil
+}
 
-		pkt, err := BuildStreamPacket(sh.streamID, sh.lsd, sh.frameNum, true, payload)
+func (sh *StreamHandler) sendFrame(payload [16]byte, isLast bool) error {
+	if sh.frameNum > 0 && sh.frameNum%metaRotateFrames == 0 {
+		if err := sh.rotateMeta(); err != nil {
+			return err
+		}
+	}
+
+	if sh.txCipher != nil {
+		sh.txCipher.apply(&payload, sh.meta, sh.frameNum)
+	}
+	if sh.signer != nil {
+		sh.digest.Add(payload)
+	}
+
+	pkt, err := BuildStreamPacket(sh.streamID, sh.lsd, sh.frameNum, isLast, payload)
+	if err != nil {
+		return err
+	}
+	if err := sh.writePacket(pkt); err != nil {
+		return err
+	}
+	sh.frameNum++
+	return nil
+}
+
+// SetReflector changes where stream packets are sent.
+func (sh *StreamHandler) SetReflector(conn *net.UDPConn, addr *net.UDPAddr) {
+	sh.connMu.Lock()
+	defer sh.connMu.Unlock()
+	sh.udpConn = conn
+	sh.reflector = addr
+}
+
+func (sh *StreamHandler) writePacket(pkt []byte) error {
+	sh.connMu.Lock()
+	conn, addr := sh.udpConn, sh.reflector
+	sh.connMu.Unlock()
+	if _, err := conn.WriteToUDP(pkt, addr); err != nil {
+		return err
+	}
+	if sh.tap != nil {
+		sh.tap(pkt)
+	}
+	return nil
+}
+
+func (sh *StreamHandler) sendSignature() error {
+	sig, err := SignDigest(sh.signer, sh.digest)
+	if err != nil {
+		return fmt.Errorf("failed to sign stream: %w", err)
+	}
+	sh.digest = StreamDigest{}
+
+	for i := 0; i < SignatureFrames; i++ {
+		var payload [16]byte
+		copy(payload[:], sig[i*16:])
+		pkt, err := BuildStreamPacket(sh.streamID, sh.lsd, uint16(signatureFrameStart+i), i == SignatureFrames-1, payload)
 		if err != nil {
 			return err
 		}
-		if _, err := sh.udpConn.WriteToUDP(pkt, sh.reflector); err != nil {
+		if err := sh.writePacket(pkt); err != nil {
 			return err
 		}
-		sh.frameNum++
-		sh.pcmBuffer = sh.pcmBuffer[:0]
 	}
-
 	return nil
 }
 
+// SetTap registers fn to receive a copy of every stream packet sent to the
+// reflector, e.g. to feed an RF modulator.
+func (sh *StreamHandler) SetTap(fn func(pkt []byte)) {
+	sh.tap = fn
+}
+
 func (sh *StreamHandler) Finalize() error {
 	return sh.SendPCMFrame(nil, true)
 }
 
 func (sh *StreamHandler) HandleIncomingPacket(data []byte, wantPCM bool) ([]byte, error) {
-	pkt, _, err := ParseStreamPacketWithLSF(data)
+	pkt, lsf, err := ParseStreamPacketWithLSF(data)
 	if err != nil {
 		return nil, err
 	}
-
-	part1, err := sh.codec2Inst.Decode(pkt.Payload[0:8])
-	if err != nil {
+	if lsf.Type.Signed && IsSignatureFrame(pkt.FrameNum) {
+		if pkt.IsLast() {
+			sh.rxMu.Lock()
+			sh.releaseRxStream(pkt.StreamID)
+			sh.rxMu.Unlock()
+		}
+		return nil, nil
+	}
+	if err := sh.Decrypt(pkt, lsf); err != nil {
 		return nil, err
 	}
-	part2, err := sh.codec2Inst.Decode(pkt.Payload[8:16])
-	if err != nil {
+
+	sh.rxMu.Lock()
+	if sh.rxDecoders == nil {
+		sh.rxMu.Unlock()
+		return nil, fmt.Errorf("stream handler closed")
+	}
+	pcm8k, err := sh.decodePayload(pkt.StreamID, lsf.Type.DataType, pkt.Payload)
+	if pkt.IsLast() {
+		sh.releaseRxStream(pkt.StreamID)
+	}
+	sh.rxMu.Unlock()
+	if err != nil || pcm8k == nil {
 		return nil, err
 	}
-	pcm8k := make([]int16, 0, len(part1)+len(part2))
-	pcm8k = append(pcm8k, part1...)
-	pcm8k = append(pcm8k, part2...)
 
 	if wantPCM {
 		out := make([]byte, len(pcm8k)*2)
@@ -169,8 +530,98 @@ func (sh *StreamHandler) HandleIncomingPacket(data []byte, wantPCM bool) ([]byte
 	return sh.muBuf, nil
 }
 
+// rxStream returns the receive state of an incoming stream, creating it
+// when the stream starts. Each stream gets its own Codec2 and cipher state,
+// so overlapping streams and successive overs don't bleed into each other.
+func (sh *StreamHandler) rxStream(streamID uint16) *rxDecoder {
+	if d, ok := sh.rxDecoders[streamID]; ok {
+		d.lastUsed = time.Now()
+		return d
+	}
+
+	if len(sh.rxDecoders) >= maxRxDecoders {
+		var oldest uint16
+		var oldestTime time.Time
+		for id, d := range sh.rxDecoders {
+			if oldestTime.IsZero() || d.lastUsed.Before(oldestTime) {
+				oldest, oldestTime = id, d.lastUsed
+			}
+		}
+		sh.releaseRxStream(oldest)
+	}
+
+	d := &rxDecoder{lastUsed: time.Now()}
+	sh.rxDecoders[streamID] = d
+	return d
+}
+
+// rxCodec returns the decoder for an incoming stream.
+func (sh *StreamHandler) rxCodec(streamID uint16, mode int) (*Codec2, error) {
+	d := sh.rxStream(streamID)
+	if d.codec != nil {
+		if d.codec.mode == mode {
+			return d.codec, nil
+		}
+		d.codec.Close()
+		d.codec = nil
+	}
+
+	c, err := New(mode)
+	if err != nil {
+		return nil, fmt.Errorf("Codec2 init failed: %w", err)
+	}
+	d.codec = c
+	return c, nil
+}
+
+func (sh *StreamHandler) releaseRxStream(streamID uint16) {
+	if d, ok := sh.rxDecoders[streamID]; ok {
+		if d.codec != nil {
+			d.codec.Close()
+		}
+		delete(sh.rxDecoders, streamID)
+	}
+}
+
+// decodePayload decodes the voice part of a stream frame according to the
+// data type in its LSF. Data-only frames return no audio.
+func (sh *StreamHandler) decodePayload(streamID uint16, dt DataType, payload [16]byte) ([]int16, error) {
+	switch dt {
+	case DataTypeVoice:
+		c, err := sh.rxCodec(streamID, MODE_3200)
+		if err != nil {
+			return nil, err
+		}
+		part1, err := c.Decode(payload[0:8])
+		if err != nil {
+			return nil, err
+		}
+		part2, err := c.Decode(payload[8:16])
+		if err != nil {
+			return nil, err
+		}
+		pcm8k := make([]int16, 0, len(part1)+len(part2))
+		pcm8k = append(pcm8k, part1...)
+		return append(pcm8k, part2...), nil
+	case DataTypeVoiceData:
+		c, err := sh.rxCodec(streamID, MODE_1600)
+		if err != nil {
+			return nil, err
+		}
+		return c.Decode(payload[0:8])
+	default:
+		return nil, nil
+	}
+}
+
 func (sh *StreamHandler) Close() {
-	if sh.codec2Inst != nil {
-		sh.codec2Inst.Close()
+	sh.rxMu.Lock()
+	for id := range sh.rxDecoders {
+		sh.releaseRxStream(id)
+	}
+	sh.rxDecoders = nil
+	sh.rxMu.Unlock()
+	if sh.txCodec != nil {
+		sh.txCodec.Close()
 	}
 }
@@ -2,6 +2,9 @@ package m17
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"net"
 	"testing"
 	"time"
@@ -17,7 +20,7 @@ func newTestStreamHandler(t *testing.T) (*StreamHandler, *net.UDPConn) {
 	if err != nil {
 		t.Fatalf("listen sender: %v", err)
 	}
-	sh, err := NewStreamHandler(sender, reflector.LocalAddr().(*net.UDPAddr), "SRC", "DST")
+	sh, err := NewStreamHandler(sender, reflector.LocalAddr().(*net.UDPAddr), "SRC", "DST", 0, StreamModeVoice)
 	if err != nil {
 		t.Fatalf("NewStreamHandler: %v", err)
 	}
@@ -129,3 +132,444 @@ func TestSendPCMFramePadded(t *testing.T) {
 		t.Fatalf("expected last frame")
 	}
 }
+
+func TestNewStreamHandlerCAN(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+	addr := conn.LocalAddr().(*net.UDPAddr)
+
+	sh, err := NewStreamHandler(conn, addr, "SRC", "DST", 9, StreamModeVoice)
+	if err != nil {
+		t.Fatalf("NewStreamHandler: %v", err)
+	}
+	defer sh.Close()
+	lsf, err := ParseLSF(sh.lsd[:])
+	if err != nil {
+		t.Fatalf("ParseLSF: %v", err)
+	}
+	if lsf.Type.CAN != 9 {
+		t.Fatalf("expected CAN 9, got %d", lsf.Type.CAN)
+	}
+
+	if _, err := NewStreamHandler(conn, addr, "SRC", "DST", MaxCAN+1, StreamModeVoice); err == nil {
+		t.Fatalf("expected error for out of range CAN")
+	}
+}
+
+func TestStreamHandlerSetPosition(t *testing.T) {
+	sh, reflector := newTestStreamHandler(t)
+	defer sh.Close()
+	defer sh.udpConn.Close()
+	defer reflector.Close()
+
+	pos := &GNSS{Latitude: 41.5, Longitude: -72.5, HasPosition: true}
+	if err := sh.SetPosition(pos); err != nil {
+		t.Fatalf("SetPosition: %v", err)
+	}
+	lsf, err := ParseLSF(sh.lsd[:])
+	if err != nil {
+		t.Fatalf("ParseLSF: %v", err)
+	}
+	if lsf.Type.EncryptionSubtype != MetaGNSS {
+		t.Fatalf("expected GNSS META subtype, got %d", lsf.Type.EncryptionSubtype)
+	}
+	if got := DecodeGNSS(lsf.Meta); !got.HasPosition {
+		t.Fatalf("expected position in META, got %+v", got)
+	}
+
+	if err := sh.SetPosition(nil); err != nil {
+		t.Fatalf("SetPosition(nil): %v", err)
+	}
+	lsf, err = ParseLSF(sh.lsd[:])
+	if err != nil {
+		t.Fatalf("ParseLSF: %v", err)
+	}
+	if lsf.Type.EncryptionSubtype != MetaText || lsf.Meta != [14]byte{} {
+		t.Fatalf("expected cleared META, got %+v", lsf)
+	}
+}
+
+func TestStreamHandlerRotatesMeta(t *testing.T) {
+	sh, reflector := newTestStreamHandler(t)
+	defer sh.Close()
+	defer sh.udpConn.Close()
+	defer reflector.Close()
+
+	if err := sh.SetPosition(&GNSS{Latitude: 1, Longitude: 2, HasPosition: true}); err != nil {
+		t.Fatalf("SetPosition: %v", err)
+	}
+	if err := sh.SetText("hello from the test bench"); err != nil {
+		t.Fatalf("SetText: %v", err)
+	}
+
+	pcm := make([]int16, 320*metaRotateFrames*3)
+	if err := sh.SendPCMFrame(pcm, true); err != nil {
+		t.Fatalf("SendPCMFrame: %v", err)
+	}
+
+	var subtypes []uint8
+	var text TextAssembler
+	var gotText string
+	buf := make([]byte, 128)
+	for i := 0; i < metaRotateFrames*3; i++ {
+		reflector.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := reflector.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("ReadFromUDP: %v", err)
+		}
+		_, lsf, err := ParseStreamPacketWithLSF(buf[:n])
+		if err != nil {
+			t.Fatalf("ParseStreamPacketWithLSF: %v", err)
+		}
+		if i%metaRotateFrames == 0 {
+			subtypes = append(subtypes, lsf.Type.EncryptionSubtype)
+		}
+		if lsf.Type.EncryptionSubtype == MetaText {
+			if s, ok := text.Add(lsf.Meta); ok {
+				gotText = s
+			}
+		}
+	}
+
+	want := []uint8{MetaGNSS, MetaText, MetaText}
+	for i := range want {
+		if subtypes[i] != want[i] {
+			t.Fatalf("META rotation %v, want %v", subtypes, want)
+		}
+	}
+	if gotText != "hello from the test bench" {
+		t.Fatalf("reassembled text %q", gotText)
+	}
+}
+
+func TestQueueDataVoiceData(t *testing.T) {
+	reflector, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	if err != nil {
+		t.Fatalf("listen reflector: %v", err)
+	}
+	defer reflector.Close()
+	sender, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	if err != nil {
+		t.Fatalf("listen sender: %v", err)
+	}
+	defer sender.Close()
+
+	voice, voiceReflector := newTestStreamHandler(t)
+	defer voice.Close()
+	defer voice.udpConn.Close()
+	defer voiceReflector.Close()
+	if _, err := voice.QueueData([]byte("x")); err == nil {
+		t.Fatal("QueueData accepted data in 3200 mode")
+	}
+
+	sh, err := NewStreamHandler(sender, reflector.LocalAddr().(*net.UDPAddr), "SRC", "DST", 0, StreamModeVoiceData)
+	if err != nil {
+		t.Fatalf("NewStreamHandler: %v", err)
+	}
+	defer sh.Close()
+	if n, err := sh.QueueData([]byte("0123456789")); err != nil || n != 16 {
+		t.Fatalf("QueueData = %d, %v; want 16 bytes queued", n, err)
+	}
+	if _, err := sh.QueueData(make([]byte, MaxTxData)); err == nil {
+		t.Fatal("QueueData accepted more than MaxTxData")
+	}
+
+	if err := sh.SendPCMFrame(make([]int16, 3*320), true); err != nil {
+		t.Fatalf("SendPCMFrame: %v", err)
+	}
+	want := [][]byte{[]byte("01234567"), []byte("89\x00\x00\x00\x00\x00\x00"), make([]byte, 8)}
+	buf := make([]byte, 128)
+	for i, w := range want {
+		reflector.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := reflector.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("ReadFromUDP: %v", err)
+		}
+		pkt, err := ParseStreamPacket(buf[:n])
+		if err != nil {
+			t.Fatalf("ParseStreamPacket: %v", err)
+		}
+		if !bytes.Equal(pkt.Payload[8:16], w) {
+			t.Errorf("frame %d data %q, want %q", i, pkt.Payload[8:16], w)
+		}
+	}
+}
+
+func TestSendPCMFrameVoiceData(t *testing.T) {
+	reflector, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	if err != nil {
+		t.Fatalf("listen reflector: %v", err)
+	}
+	defer reflector.Close()
+	sender, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	if err != nil {
+		t.Fatalf("listen sender: %v", err)
+	}
+	defer sender.Close()
+
+	sh, err := NewStreamHandler(sender, reflector.LocalAddr().(*net.UDPAddr), "SRC", "DST", 0, StreamModeVoiceData)
+	if err != nil {
+		t.Fatalf("NewStreamHandler: %v", err)
+	}
+	defer sh.Close()
+
+	pcm := make([]int16, 320)
+	for i := range pcm {
+		pcm[i] = int16(i * 3)
+	}
+
+	c2, err := New(MODE_1600)
+	if err != nil {
+		t.Fatalf("codec2 init: %v", err)
+	}
+	defer c2.Close()
+	voice, err := c2.Encode(pcm)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	if err := sh.SendPCMFrame(pcm, true); err != nil {
+		t.Fatalf("SendPCMFrame: %v", err)
+	}
+
+	reflector.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 128)
+	n, _, err := reflector.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("ReadFromUDP: %v", err)
+	}
+	pkt, lsf, err := ParseStreamPacketWithLSF(buf[:n])
+	if err != nil {
+		t.Fatalf("ParseStreamPacketWithLSF: %v", err)
+	}
+	if lsf.Type.DataType != DataTypeVoiceData {
+		t.Fatalf("expected voice+data stream, got %v", lsf.Type.DataType)
+	}
+	if !bytes.Equal(pkt.Payload[0:8], voice) {
+		t.Fatalf("voice payload mismatch")
+	}
+
+	out, err := sh.HandleIncomingPacket(buf[:n], true)
+	if err != nil {
+		t.Fatalf("HandleIncomingPacket: %v", err)
+	}
+	if len(out) != 640 {
+		t.Fatalf("expected 320 PCM samples, got %d bytes", len(out))
+	}
+}
+
+func TestStreamHandlerEncryptsWithKey(t *testing.T) {
+	sh, reflector := newTestStreamHandler(t)
+	defer sh.Close()
+	defer sh.udpConn.Close()
+	defer reflector.Close()
+
+	key, err := NewKey(EncryptionAES, bytes.Repeat([]byte{0x42}, 32))
+	if err != nil {
+		t.Fatalf("NewKey: %v", err)
+	}
+	if err := sh.SetKey(key); err != nil {
+		t.Fatalf("SetKey: %v", err)
+	}
+	if err := sh.SetText("not sent while encrypting"); err != nil {
+		t.Fatalf("SetText: %v", err)
+	}
+	if err := sh.SendPCMFrame(make([]int16, 320), true); err != nil {
+		t.Fatalf("SendPCMFrame: %v", err)
+	}
+
+	buf := make([]byte, 128)
+	reflector.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := reflector.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("ReadFromUDP: %v", err)
+	}
+	pkt := buf[:n]
+	sp, lsf, err := ParseStreamPacketWithLSF(pkt)
+	if err != nil {
+		t.Fatalf("ParseStreamPacketWithLSF: %v", err)
+	}
+	if lsf.Type.Encryption != EncryptionAES || lsf.Type.EncryptionSubtype != AES256 {
+		t.Fatalf("unexpected LSF type %+v", lsf.Type)
+	}
+	if lsf.Meta == [14]byte{} {
+		t.Fatal("expected nonce in META")
+	}
+
+	c2, err := New(MODE_3200)
+	if err != nil {
+		t.Fatalf("codec2 init: %v", err)
+	}
+	defer c2.Close()
+	plain, _ := c2.Encode(make([]int16, 160))
+	if bytes.Equal(sp.Payload[0:8], plain) {
+		t.Fatal("payload was not encrypted")
+	}
+
+	rx, rxReflector := newTestStreamHandler(t)
+	defer rx.Close()
+	defer rx.udpConn.Close()
+	defer rxReflector.Close()
+	if rx.CanDecrypt(lsf.Type) {
+		t.Fatal("CanDecrypt true without key")
+	}
+	if _, err := rx.HandleIncomingPacket(pkt, true); err != ErrNoKey {
+		t.Fatalf("expected ErrNoKey, got %v", err)
+	}
+	if err := rx.SetKey(key); err != nil {
+		t.Fatalf("SetKey: %v", err)
+	}
+	if err := rx.Decrypt(sp, lsf); err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if !bytes.Equal(sp.Payload[0:8], plain) {
+		t.Fatalf("decrypted payload %X, want %X", sp.Payload[0:8], plain)
+	}
+}
+
+func TestStreamHandlerSignsStream(t *testing.T) {
+	sh, reflector := newTestStreamHandler(t)
+	defer sh.Close()
+	defer sh.udpConn.Close()
+	defer reflector.Close()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	if err := sh.SetSigningKey(priv); err != nil {
+		t.Fatalf("SetSigningKey: %v", err)
+	}
+	if err := sh.SendPCMFrame(make([]int16, 640), false); err != nil {
+		t.Fatalf("SendPCMFrame: %v", err)
+	}
+	if err := sh.Finalize(); err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+
+	var v StreamVerifier
+	var frames []uint16
+	buf := make([]byte, 128)
+	for i := 0; i < 2+SignatureFrames; i++ {
+		reflector.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := reflector.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("ReadFromUDP: %v", err)
+		}
+		sp, lsf, err := ParseStreamPacketWithLSF(buf[:n])
+		if err != nil {
+			t.Fatalf("ParseStreamPacketWithLSF: %v", err)
+		}
+		if !lsf.Type.Signed {
+			t.Fatal("expected signed stream bit")
+		}
+		frames = append(frames, sp.FrameNum)
+		v.Add(sp)
+	}
+
+	want := []uint16{0, 1, 0x7FFC, 0x7FFD, 0x7FFE, 0xFFFF}
+	for i := range want {
+		if frames[i] != want[i] {
+			t.Fatalf("frame numbers %04X, want %04X", frames, want)
+		}
+	}
+	if !v.Verify(&priv.PublicKey) {
+		t.Fatal("stream signature did not verify")
+	}
+}
+
+func TestHandleIncomingPacketDecoderPerStream(t *testing.T) {
+	sh, reflector := newTestStreamHandler(t)
+	defer sh.Close()
+	defer sh.udpConn.Close()
+	defer reflector.Close()
+
+	lsf, _ := BuildLSF("DST", "SRC", LSFType{Stream: true, DataType: DataTypeVoice}, [14]byte{})
+	lsd := LSFToLSD(lsf)
+	send := func(id, fn uint16, last bool) {
+		t.Helper()
+		pkt, _ := BuildStreamPacket(id, lsd, fn, last, [16]byte{})
+		if _, err := sh.HandleIncomingPacket(pkt, true); err != nil {
+			t.Fatalf("HandleIncomingPacket: %v", err)
+		}
+	}
+
+	send(1, 0, false)
+	send(2, 0, false)
+	if len(sh.rxDecoders) != 2 {
+		t.Fatalf("expected a decoder per stream, got %d", len(sh.rxDecoders))
+	}
+	first := sh.rxDecoders[1].codec
+	for _, d := range sh.rxDecoders {
+		if d.codec == sh.txCodec {
+			t.Fatal("RX decoder shares the TX codec")
+		}
+	}
+
+	send(1, 1, false)
+	if sh.rxDecoders[1].codec != first {
+		t.Fatal("decoder replaced mid-stream")
+	}
+	send(1, 2, true)
+	if _, ok := sh.rxDecoders[1]; ok {
+		t.Fatal("decoder not released at end of stream")
+	}
+
+	for id := uint16(10); id < 10+maxRxDecoders+2; id++ {
+		send(id, 0, false)
+	}
+	if len(sh.rxDecoders) != maxRxDecoders {
+		t.Fatalf("expected %d decoders, got %d", maxRxDecoders, len(sh.rxDecoders))
+	}
+}
+
+func TestDecryptCipherPerStream(t *testing.T) {
+	sh, reflector := newTestStreamHandler(t)
+	defer sh.Close()
+	defer sh.udpConn.Close()
+	defer reflector.Close()
+
+	key, err := NewKey(EncryptionScrambler, []byte{0x12, 0x34})
+	if err != nil {
+		t.Fatalf("NewKey: %v", err)
+	}
+	if err := sh.SetKey(key); err != nil {
+		t.Fatalf("SetKey: %v", err)
+	}
+	lsf := &LSF{Type: LSFType{Stream: true, DataType: DataTypeVoice, Encryption: EncryptionScrambler, EncryptionSubtype: Scrambler16}}
+
+	var plain [16]byte
+	for i := range plain {
+		plain[i] = byte(i)
+	}
+	tx := map[uint16]*streamCipher{1: newStreamCipher(key), 2: newStreamCipher(key)}
+	recv := func(id, fn uint16) {
+		t.Helper()
+		pkt := &StreamPacket{StreamID: id, FrameNum: fn, Payload: plain}
+		tx[id].apply(&pkt.Payload, lsf.Meta, fn)
+		if err := sh.Decrypt(pkt, lsf); err != nil {
+			t.Fatalf("Decrypt: %v", err)
+		}
+		if pkt.Payload != plain {
+			t.Fatalf("stream %d frame %d decrypted to %X", id, fn, pkt.Payload)
+		}
+	}
+
+	// Stream 2 starts while stream 1 is far along; neither may rewind the
+	// other's keystream.
+	for fn := uint16(0); fn < 40; fn++ {
+		recv(1, fn)
+	}
+	recv(2, 0)
+	if c := sh.rxDecoders[1].cipher; c.frameNum != 39 {
+		t.Fatalf("stream 1 cipher at frame %d after stream 2 started, want 39", c.frameNum)
+	}
+	recv(1, 40)
+	recv(2, 1)
+	if sh.rxDecoders[1].cipher == sh.rxDecoders[2].cipher {
+		t.Fatal("streams share a cipher")
+	}
+}
@@ -0,0 +1,78 @@
+package m17
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+const (
+	TextBlockSize  = 13
+	MaxTextBlocks  = 4
+	MaxTextMessage = TextBlockSize * MaxTextBlocks
+)
+
+// EncodeTextBlocks splits text into META blocks. The first byte of each
+// block is the control byte: the upper nibble is a bitmap of all blocks in
+// the message and the lower nibble marks which block this one is.
+func EncodeTextBlocks(text string) ([][14]byte, error) {
+	if len(text) > MaxTextMessage {
+		return nil, fmt.Errorf("text too long: max %d bytes", MaxTextMessage)
+	}
+	if text == "" {
+		return nil, nil
+	}
+
+	n := (len(text) + TextBlockSize - 1) / TextBlockSize
+	total := byte(1<<n-1) << 4
+
+	blocks := make([][14]byte, n)
+	for i := range blocks {
+		start := i * TextBlockSize
+		end := min(start+TextBlockSize, len(text))
+		chunk := text[start:end] + strings.Repeat(" ", TextBlockSize-(end-start))
+
+		blocks[i][0] = total | 1<<i
+		copy(blocks[i][1:], chunk)
+	}
+	return blocks, nil
+}
+
+// TextAssembler collects text META blocks from successive LSDs and reports
+// the message once every block has been seen.
+type TextAssembler struct {
+	blocks [MaxTextBlocks][TextBlockSize]byte
+	total  byte
+	have   byte
+}
+
+func (a *TextAssembler) Reset() {
+	*a = TextAssembler{}
+}
+
+func (a *TextAssembler) Add(meta [14]byte) (string, bool) {
+	total := meta[0] >> 4
+	index := meta[0] & 0xF
+	if total == 0 || bits.OnesCount8(index) != 1 || index&total == 0 {
+		return "", false
+	}
+
+	if total != a.total {
+		a.Reset()
+		a.total = total
+	}
+	copy(a.blocks[bits.TrailingZeros8(index)][:], meta[1:])
+	a.have |= index
+
+	if a.have&a.total != a.total {
+		return "", false
+	}
+
+	var sb strings.Builder
+	for i := 0; i < MaxTextBlocks; i++ {
+		if a.total&(1<<i) != 0 {
+			sb.Write(a.blocks[i][:])
+		}
+	}
+	return strings.TrimRight(sb.String(), " \x00"), true
+}
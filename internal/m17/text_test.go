@@ -0,0 +1,53 @@
+package m17
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodeTextBlocksControlByte(t *testing.T) {
+	blocks, err := EncodeTextBlocks("FN31 / FT-991A / hi")
+	if err != nil {
+		t.Fatalf("EncodeTextBlocks: %v", err)
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("expected 2 blocks, got %d", len(blocks))
+	}
+	if blocks[0][0] != 0x31 || blocks[1][0] != 0x32 {
+		t.Fatalf("unexpected control bytes %#02x %#02x", blocks[0][0], blocks[1][0])
+	}
+
+	if _, err := EncodeTextBlocks(strings.Repeat("x", MaxTextMessage+1)); err == nil {
+		t.Fatalf("expected error for long text")
+	}
+}
+
+func TestTextAssemblerOutOfOrder(t *testing.T) {
+	text := "QTH FN31 / RIG OpenRTX / 73 de test"
+	blocks, err := EncodeTextBlocks(text)
+	if err != nil {
+		t.Fatalf("EncodeTextBlocks: %v", err)
+	}
+
+	var a TextAssembler
+	order := []int{2, 0}
+	for _, i := range order {
+		if _, ok := a.Add(blocks[i]); ok {
+			t.Fatalf("message complete before all blocks seen")
+		}
+	}
+	got, ok := a.Add(blocks[1])
+	if !ok {
+		t.Fatalf("expected complete message")
+	}
+	if got != text {
+		t.Fatalf("got %q, want %q", got, text)
+	}
+}
+
+func TestTextAssemblerIgnoresEmptyMeta(t *testing.T) {
+	var a TextAssembler
+	if _, ok := a.Add([14]byte{}); ok {
+		t.Fatalf("empty META treated as text")
+	}
+}
@@ -15,25 +15,74 @@ type Event int
 
 const (
 	EventNACK Event = iota
+	// EventReconnecting is sent before each reconnect attempt and
+	// EventReconnected once the reflector has acknowledged it.
+	EventReconnecting
+	EventReconnected
 )
 
+// maxDatagramSize fits the largest datagram a reflector sends, a packet
+// mode packet with the magic, LSF and full payload.
+const maxDatagramSize = 4 + 30 + m17.MaxPacketPayload
+
+// ReconnectPolicy controls how a client that lost its reflector tries to
+// connect again. The delay between attempts starts at InitialDelay and
+// doubles up to MaxDelay; after MaxAttempts failed attempts, or never if
+// it is zero, the client gives up and closes.
+type ReconnectPolicy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	MaxAttempts  int
+}
+
+var DefaultReconnectPolicy = ReconnectPolicy{
+	InitialDelay: time.Second,
+	MaxDelay:     time.Minute,
+}
+
 type ReflectorClient struct {
 	UDPConn    *net.UDPConn
 	RemoteAddr *net.UDPAddr
 	Callsign   string
 	Module     byte
 	Designator string
+	// ListenOnly clients connect with LSTN and only receive.
+	ListenOnly bool
 	connected  bool
 	lastPing   time.Time
 	ctx        context.Context
 	cancel     context.CancelFunc
-
-	Packets   chan []byte
-	Events    chan Event
-	closeOnce sync.Once
+	// mux is set when UDPConn is a Mux socket shared with other clients.
+	mux *Mux
+
+	// mu guards the connection state and RemoteAddr, which change while
+	// reconnecting.
+	mu           sync.Mutex
+	address      string
+	reconnect    *ReconnectPolicy
+	reconnecting bool
+	ackn         chan struct{}
+
+	Packets     chan []byte
+	DataPackets chan []byte
+	Events      chan Event
+	closeOnce   sync.Once
 }
 
 func NewReflectorClient(ctx context.Context, reflectorAddr, callsign string, module byte) (*ReflectorClient, error) {
+	return newReflectorClient(ctx, reflectorAddr, callsign, module, false, nil)
+}
+
+// NewListenClient connects to a reflector module with LSTN, which the
+// reflector accepts for receive-only clients.
+func NewListenClient(ctx context.Context, reflectorAddr, callsign string, module byte) (*ReflectorClient, error) {
+	return newReflectorClient(ctx, reflectorAddr, callsign, module, true, nil)
+}
+
+// newReflectorClient connects over mux if it is not nil. A second client
+// for a reflector already reached through mux gets its own socket, as it
+// would otherwise be indistinguishable from the first.
+func newReflectorClient(ctx context.Context, reflectorAddr, callsign string, module byte, listenOnly bool, mux *Mux) (*ReflectorClient, error) {
 	remote, err := net.ResolveUDPAddr("udp", reflectorAddr)
 	if err != nil {
 		return nil, err
@@ -44,37 +93,57 @@ func NewReflectorClient(ctx context.Context, reflectorAddr, callsign string, mod
 		network = "udp6"
 	}
 
-	local := &net.UDPAddr{Port: 0}
+	ctx, cancel := context.WithCancel(ctx)
 
-	conn, err := net.ListenUDP(network, local)
-	if err != nil {
-		return nil, err
+	client := &ReflectorClient{
+		RemoteAddr:  remote,
+		Callsign:    callsign,
+		Module:      module,
+		ListenOnly:  listenOnly,
+		lastPing:    time.Now(),
+		ctx:         ctx,
+		cancel:      cancel,
+		address:     reflectorAddr,
+		ackn:        make(chan struct{}, 1),
+		Packets:     make(chan []byte, 100),
+		DataPackets: make(chan []byte, 10),
+		Events:      make(chan Event, 10),
 	}
 
-	ctx, cancel := context.WithCancel(ctx)
+	if mux != nil {
+		err := mux.register(network, client)
+		if errors.Is(err, errAddrInUse) {
+			// Only one client per reflector fits on the shared port.
+			log.Warn("Reflector already connected on the shared port, using a random port", "reflector", reflectorAddr)
+		} else if err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+	if client.mux == nil {
+		conn, err := net.ListenUDP(network, &net.UDPAddr{Port: 0})
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		client.UDPConn = conn
+	}
 
-	client := &ReflectorClient{
-		UDPConn:    conn,
-		RemoteAddr: remote,
-		Callsign:   callsign,
-		Module:     module,
-		lastPing:   time.Now(),
-		ctx:        ctx,
-		cancel:     cancel,
-		Packets:    make(chan []byte, 100),
-		Events:     make(chan Event, 10),
-	}
-
-	if err := client.sendControl(func() ([]byte, error) {
-		return m17.BuildCONN(client.Callsign, client.Module)
-	}); err != nil {
+	if err := client.sendControl(client.buildConnect); err != nil {
 		log.Error("Error sending CONN", "err", err, "reflector", client.Designator)
-		conn.Close()
+		client.releaseConn()
 		cancel()
 		return nil, err
 	}
 
-	go client.listen()
+	if client.mux == nil {
+		go client.listen()
+	} else {
+		go func() {
+			<-client.ctx.Done()
+			client.Close()
+		}()
+	}
 	go client.monitorPing()
 
 	return client, nil
@@ -89,15 +158,18 @@ func NewTestClient(ctx context.Context, conn *net.UDPConn, remote *net.UDPAddr,
 		events = make(chan Event, 10)
 	}
 	return &ReflectorClient{
-		UDPConn:    conn,
-		RemoteAddr: remote,
-		Callsign:   callsign,
-		Module:     module,
-		Designator: designator,
-		ctx:        ctx,
-		cancel:     cancel,
-		Packets:    packets,
-		Events:     events,
+		UDPConn:     conn,
+		RemoteAddr:  remote,
+		Callsign:    callsign,
+		Module:      module,
+		Designator:  designator,
+		ctx:         ctx,
+		cancel:      cancel,
+		address:     remote.String(),
+		ackn:        make(chan struct{}, 1),
+		Packets:     packets,
+		DataPackets: make(chan []byte, 10),
+		Events:      events,
 	}
 }
 
@@ -106,30 +178,48 @@ func (c *ReflectorClient) Conn() *net.UDPConn {
 }
 
 func (c *ReflectorClient) Addr() *net.UDPAddr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.RemoteAddr
 }
 
 func (c *ReflectorClient) Name() string {
-	return c.RemoteAddr.String()
+	return c.Addr().String()
+}
+
+// EnableReconnect makes the client reconnect according to p instead of
+// closing when the reflector stops pinging or disconnects it.
+func (c *ReflectorClient) EnableReconnect(p ReconnectPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reconnect = &p
 }
 
 func (c *ReflectorClient) Done() <-chan struct{} {
 	return c.ctx.Done()
 }
 
+func (c *ReflectorClient) buildConnect() ([]byte, error) {
+	if c.ListenOnly {
+		return m17.BuildLSTN(c.Callsign, c.Module)
+	}
+	return m17.BuildCONN(c.Callsign, c.Module)
+}
+
 func (c *ReflectorClient) sendControl(build func() ([]byte, error)) error {
 	pkt, err := build()
 	if err != nil {
 		return err
 	}
-	_, err = c.UDPConn.WriteToUDP(pkt, c.RemoteAddr)
+	_, err = c.UDPConn.WriteToUDP(pkt, c.Addr())
 	return err
 }
 
 func (c *ReflectorClient) listen() {
 	defer close(c.Packets)
+	defer close(c.DataPackets)
 
-	buf := make([]byte, 512)
+	buf := make([]byte, maxDatagramSize)
 
 	for {
 		if c.ctx.Err() != nil {
@@ -161,22 +251,42 @@ func (c *ReflectorClient) listen() {
 			return
 		}
 
-		if addr.String() != c.RemoteAddr.String() {
+		if addr.String() != c.Addr().String() {
 			log.Warn("Ignoring packet from unexpected source", "source", addr.String(), "reflector", c.Designator)
 			continue
 		}
 
-		data := append([]byte(nil), buf[:n]...)
+		c.handleDatagram(append([]byte(nil), buf[:n]...))
+	}
+}
 
-		if n >= 4 && string(data[:4]) == "M17 " {
-			select {
-			case c.Packets <- data:
-			default:
-				log.Warn("Packet channel full, dropping stream packet", "reflector", c.Designator)
-			}
-		} else {
-			c.handleControlPacket(data)
+func (c *ReflectorClient) handleDatagram(data []byte) {
+	if len(data) >= 4 && string(data[:4]) == "M17 " {
+		if !c.deliver(c.Packets, data) {
+			log.Warn("Packet channel full, dropping stream packet", "reflector", c.Designator)
+		}
+	} else if len(data) >= 4 && string(data[:4]) == m17.MagicPacket {
+		if !c.deliver(c.DataPackets, data) {
+			log.Warn("Data packet channel full, dropping packet", "reflector", c.Designator)
 		}
+	} else {
+		c.handleControlPacket(data)
+	}
+}
+
+// deliver reports false if ch is full. On a Mux, Close closes the packet
+// channels, so like sendEvent it checks under mu that the client is open.
+func (c *ReflectorClient) deliver(ch chan []byte, data []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ctx.Err() != nil {
+		return true
+	}
+	select {
+	case ch <- data:
+		return true
+	default:
+		return false
 	}
 }
 
@@ -189,21 +299,26 @@ func (c *ReflectorClient) handleControlPacket(data []byte) {
 
 	switch ctrlType {
 	case m17.CtrlACKN:
+		c.mu.Lock()
 		c.connected = true
 		c.lastPing = time.Now()
+		c.mu.Unlock()
 		log.Info("Reflector ACKN: connected", "callsign", c.Callsign, "reflector", c.Designator)
-
-	case m17.CtrlNACK:
-		log.Error("Reflector NACK: connection denied", "reflector", c.Designator)
 		select {
-		case c.Events <- EventNACK:
+		case c.ackn <- struct{}{}:
 		default:
 		}
+
+	case m17.CtrlNACK:
+		log.Error("Reflector NACK: connection denied", "reflector", c.Designator)
+		c.sendEvent(EventNACK)
 		c.Close()
 
 	case m17.CtrlPING:
 		log.Debug("Reflector PING -> sending PONG", "from", callsign, "reflector", c.Designator)
+		c.mu.Lock()
 		c.lastPing = time.Now()
+		c.mu.Unlock()
 		if err := c.sendControl(func() ([]byte, error) {
 			return m17.BuildPONG(c.Callsign)
 		}); err != nil {
@@ -212,7 +327,7 @@ func (c *ReflectorClient) handleControlPacket(data []byte) {
 
 	case m17.CtrlDISC:
 		log.Info("Reflector DISC: disconnected by reflector", "reflector", c.Designator)
-		c.Close()
+		c.lost()
 
 	default:
 		log.Warn("Unhandled control packet type", "type", ctrlType, "reflector", c.Designator)
@@ -228,15 +343,114 @@ func (c *ReflectorClient) monitorPing() {
 		case <-c.ctx.Done():
 			return
 		case <-ticker.C:
-			if time.Since(c.lastPing) > 30*time.Second && c.connected {
+			c.mu.Lock()
+			silent := c.connected && time.Since(c.lastPing) > 30*time.Second
+			c.mu.Unlock()
+			if silent {
 				log.Warn("No PING from reflector; assuming disconnected", "reflector", c.Designator)
-				c.Close()
-				return
+				c.lost()
 			}
 		}
 	}
 }
 
+// lost handles losing the reflector: without a reconnect policy the client
+// closes, otherwise it starts reconnecting unless it already is.
+func (c *ReflectorClient) lost() {
+	c.mu.Lock()
+	policy := c.reconnect
+	start := policy != nil && !c.reconnecting
+	if start {
+		c.connected = false
+		c.reconnecting = true
+	}
+	c.mu.Unlock()
+
+	if policy == nil {
+		c.Close()
+		return
+	}
+	if start {
+		go c.reconnectLoop(*policy)
+	}
+}
+
+func (c *ReflectorClient) reconnectLoop(p ReconnectPolicy) {
+	defer func() {
+		c.mu.Lock()
+		c.reconnecting = false
+		c.mu.Unlock()
+	}()
+
+	select {
+	case <-c.ackn:
+	default:
+	}
+
+	delay := p.InitialDelay
+	for attempt := 1; p.MaxAttempts == 0 || attempt <= p.MaxAttempts; attempt++ {
+		c.sendEvent(EventReconnecting)
+		log.Info("Reconnecting to reflector", "attempt", attempt, "reflector", c.Designator)
+		if err := c.reconnectOnce(); err != nil {
+			log.Warn("Reconnect attempt failed", "attempt", attempt, "err", err, "reflector", c.Designator)
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-c.ackn:
+			c.sendEvent(EventReconnected)
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, p.MaxDelay)
+	}
+
+	log.Warn("Giving up reconnecting to reflector", "reflector", c.Designator)
+	c.Close()
+}
+
+// reconnectOnce re-resolves the reflector address, within the address
+// family of the socket, and sends CONN or LSTN.
+func (c *ReflectorClient) reconnectOnce() error {
+	network := "udp4"
+	if c.Addr().IP.To4() == nil {
+		network = "udp6"
+	}
+	remote, err := net.ResolveUDPAddr(network, c.address)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	old := c.RemoteAddr
+	c.RemoteAddr = remote
+	c.mu.Unlock()
+
+	if c.mux != nil {
+		if err := c.mux.move(c, old); err != nil {
+			c.mu.Lock()
+			c.RemoteAddr = old
+			c.mu.Unlock()
+			return err
+		}
+	}
+	return c.sendControl(c.buildConnect)
+}
+
+// sendEvent is used from the reconnect goroutine, so unlike the listener
+// it has to check under mu that Close has not closed Events yet.
+func (c *ReflectorClient) sendEvent(evt Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ctx.Err() != nil {
+		return
+	}
+	select {
+	case c.Events <- evt:
+	default:
+	}
+}
+
 func (c *ReflectorClient) Disconnect() {
 	c.Close()
 }
@@ -249,7 +463,22 @@ func (c *ReflectorClient) Close() {
 		}); err != nil {
 			log.Warn("Error sending DISC", "err", err, "reflector", c.Designator)
 		}
-		c.UDPConn.Close()
+		c.releaseConn()
+		c.mu.Lock()
 		close(c.Events)
+		if c.mux != nil {
+			close(c.Packets)
+			close(c.DataPackets)
+		}
+		c.mu.Unlock()
 	})
 }
+
+// releaseConn closes the client's own socket or leaves the Mux.
+func (c *ReflectorClient) releaseConn() {
+	if c.mux != nil {
+		c.mux.unregister(c)
+		return
+	}
+	c.UDPConn.Close()
+}
@@ -7,6 +7,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/kc1awv/m17-webclient/internal/m17"
 )
 
 func TestShortDatagramHandledAsControl(t *testing.T) {
@@ -50,6 +52,76 @@ func TestShortDatagramHandledAsControl(t *testing.T) {
 	}
 }
 
+func TestPacketModeRoutedToDataPackets(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer server.Close()
+
+	client, err := NewReflectorClient(context.Background(), server.LocalAddr().String(), "TEST", 'A')
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	clientAddr := client.Conn().LocalAddr().(*net.UDPAddr)
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: clientAddr.Port}
+
+	pkt, err := m17.BuildSMS("TEST", "N0CALL", 0, "hi")
+	if err != nil {
+		t.Fatalf("BuildSMS: %v", err)
+	}
+	if _, err := server.WriteToUDP(pkt, addr); err != nil {
+		t.Fatalf("failed to send packet: %v", err)
+	}
+
+	select {
+	case got := <-client.DataPackets:
+		if string(got[:4]) != m17.MagicPacket {
+			t.Fatalf("unexpected packet %q", got[:4])
+		}
+	case <-client.Packets:
+		t.Fatalf("packet-mode datagram treated as stream")
+	case <-time.After(200 * time.Millisecond):
+		t.Fatalf("expected data packet not received")
+	}
+}
+
+func TestMaxLengthSMSReceivedWhole(t *testing.T) {
+	server := listenLoopback(t)
+	client, err := NewReflectorClient(context.Background(), server.LocalAddr().String(), "TEST", 'A')
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	text := strings.Repeat("x", m17.MaxSMSLength)
+	pkt, err := m17.BuildSMS("TEST", "N0CALL", 0, text)
+	if err != nil {
+		t.Fatalf("BuildSMS: %v", err)
+	}
+	if len(pkt) != maxDatagramSize {
+		t.Fatalf("SMS packet is %d bytes, want %d", len(pkt), maxDatagramSize)
+	}
+	if _, err := server.WriteToUDP(pkt, readConnect(t, server)); err != nil {
+		t.Fatalf("failed to send packet: %v", err)
+	}
+
+	select {
+	case got := <-client.DataPackets:
+		p, err := m17.ParsePacket(got)
+		if err != nil {
+			t.Fatalf("ParsePacket: %v", err)
+		}
+		if sms, _ := p.SMSText(); sms != text {
+			t.Fatalf("got %d bytes of SMS text, want %d", len(sms), len(text))
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected data packet not received")
+	}
+}
+
 func TestNewReflectorClientSendControlError(t *testing.T) {
 	if _, err := NewReflectorClient(context.Background(), "127.0.0.1:0", "TEST", 'A'); err == nil {
 		t.Fatalf("expected error sending CONN, got nil")
@@ -83,6 +155,125 @@ func TestReflectorClientIPv6Loopback(t *testing.T) {
 	}
 }
 
+func TestListenClientSendsLSTN(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer server.Close()
+
+	client, err := NewListenClient(context.Background(), server.LocalAddr().String(), "SWL", 'B')
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	buf := make([]byte, 256)
+	if err := server.SetReadDeadline(time.Now().Add(500 * time.Millisecond)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+	n, _, err := server.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("failed to read from client: %v", err)
+	}
+	typ, callsign, module, err := m17.ParseControlPacket(buf[:n])
+	if err != nil || typ != m17.CtrlLSTN || callsign != "SWL" || module != 'B' {
+		t.Fatalf("got %v %q %c %v, want LSTN from SWL on B", typ, callsign, module, err)
+	}
+}
+
+func TestReflectorClientReconnectsAfterDISC(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer server.Close()
+
+	client, err := NewReflectorClient(context.Background(), server.LocalAddr().String(), "TEST", 'A')
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+	client.EnableReconnect(ReconnectPolicy{InitialDelay: 20 * time.Millisecond, MaxDelay: 50 * time.Millisecond})
+
+	buf := make([]byte, 256)
+	expectCONN := func() *net.UDPAddr {
+		t.Helper()
+		if err := server.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			t.Fatalf("failed to set deadline: %v", err)
+		}
+		n, addr, err := server.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("failed to read from client: %v", err)
+		}
+		if typ, _, _, _ := m17.ParseControlPacket(buf[:n]); typ != m17.CtrlCONN {
+			t.Fatalf("expected CONN, got %q", buf[:4])
+		}
+		return addr
+	}
+
+	addr := expectCONN()
+	if _, err := server.WriteToUDP([]byte(m17.MagicACKN), addr); err != nil {
+		t.Fatalf("failed to send ACKN: %v", err)
+	}
+	if _, err := server.WriteToUDP([]byte(m17.MagicDISC), addr); err != nil {
+		t.Fatalf("failed to send DISC: %v", err)
+	}
+
+	// Let the first attempt go unanswered to exercise the backoff.
+	expectCONN()
+	addr = expectCONN()
+	if _, err := server.WriteToUDP([]byte(m17.MagicACKN), addr); err != nil {
+		t.Fatalf("failed to send ACKN: %v", err)
+	}
+
+	var events []Event
+	timeout := time.After(time.Second)
+	for len(events) == 0 || events[len(events)-1] != EventReconnected {
+		select {
+		case evt := <-client.Events:
+			events = append(events, evt)
+		case <-timeout:
+			t.Fatalf("no reconnected event, got %v", events)
+		}
+	}
+	if events[0] != EventReconnecting {
+		t.Fatalf("expected reconnecting event first, got %v", events)
+	}
+	select {
+	case <-client.Done():
+		t.Fatal("client closed after reconnecting")
+	default:
+	}
+}
+
+func TestReflectorClientGivesUpReconnecting(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer server.Close()
+
+	client, err := NewReflectorClient(context.Background(), server.LocalAddr().String(), "TEST", 'A')
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+	client.EnableReconnect(ReconnectPolicy{InitialDelay: 10 * time.Millisecond, MaxDelay: 10 * time.Millisecond, MaxAttempts: 2})
+
+	clientAddr := client.Conn().LocalAddr().(*net.UDPAddr)
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: clientAddr.Port}
+	if _, err := server.WriteToUDP([]byte(m17.MagicDISC), addr); err != nil {
+		t.Fatalf("failed to send DISC: %v", err)
+	}
+
+	select {
+	case <-client.Done():
+	case <-time.After(time.Second):
+		t.Fatal("client did not close after exhausting reconnect attempts")
+	}
+}
+
 func TestFetchReflectorsFromFile(t *testing.T) {
 	tmp, err := os.CreateTemp("", "hosts*.json")
 	if err != nil {
@@ -97,7 +288,6 @@ func TestFetchReflectorsFromFile(t *testing.T) {
 
 	ls := NewListStore()
 	ls.hostFilePath = tmp.Name()
-	ls.hostFileModTime = time.Time{}
 	ls.FetchReflectors(context.Background())
 
 	list := ls.GetReflectors()
@@ -131,7 +321,6 @@ func TestFetchModulesEmpty(t *testing.T) {
 
 	ls := NewListStore()
 	ls.hostFilePath = tmp.Name()
-	ls.hostFileModTime = time.Time{}
 	ls.moduleCache = make(map[string]cachedModules)
 	ls.FetchReflectors(context.Background())
 
@@ -155,7 +344,6 @@ func TestFetchModulesFiltersInvalid(t *testing.T) {
 
 	ls := NewListStore()
 	ls.hostFilePath = tmp.Name()
-	ls.hostFileModTime = time.Time{}
 	ls.moduleCache = make(map[string]cachedModules)
 	ls.FetchReflectors(context.Background())
 
@@ -179,7 +367,6 @@ func TestFetchReflectorsCanceled(t *testing.T) {
 
 	ls := NewListStore()
 	ls.hostFilePath = tmp.Name()
-	ls.hostFileModTime = time.Time{}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
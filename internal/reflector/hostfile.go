@@ -0,0 +1,346 @@
+package reflector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/kc1awv/m17-webclient/internal/logger"
+)
+
+// maxHostFileSize bounds the download; the public host file is well under
+// a megabyte.
+const maxHostFileSize = 8 << 20
+
+// HostFileStatus reports how current one host file is. Age is the time
+// since the copy in use was last fetched or confirmed unchanged, or since
+// the fallback copy was saved.
+type HostFileStatus struct {
+	Source      string     `json:"source"`
+	Reflectors  int        `json:"reflectors"`
+	LastAttempt *time.Time `json:"last_attempt,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	AgeSeconds  float64    `json:"age_seconds,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	// Fallback is set while the host file comes from the copy on disk
+	// because it could not be fetched since startup.
+	Fallback bool `json:"fallback,omitempty"`
+}
+
+// hostSource is one host file in the ordered list. A remote host file is
+// revalidated with the ETag and Last-Modified of the last response and
+// saved to cache.
+type hostSource struct {
+	path         string
+	name         string
+	cache        string
+	modTime      time.Time
+	etag         string
+	lastModified string
+
+	// Guarded by ListStore.mu.
+	data        *hostfile
+	lastAttempt time.Time
+	lastSuccess time.Time
+	dataTime    time.Time
+	fetchErr    error
+	fallback    bool
+}
+
+// mergedReflector is a reflector after merging all sources, with the
+// names of the sources that set it.
+type mergedReflector struct {
+	hostfileReflector
+	sources []string
+}
+
+func isRemoteHostFile(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// sourceName is how a host file is shown to clients: URLs lose their
+// credentials and query, which may hold tokens, and local files their
+// directory.
+func sourceName(path string) string {
+	if !isRemoteHostFile(path) {
+		return filepath.Base(path)
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host + u.Path
+}
+
+func (ls *ListStore) newSources() []*hostSource {
+	var paths []string
+	for _, p := range strings.Split(ls.hostFilePath, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	if ls.overridesPath != "" {
+		paths = append(paths, ls.overridesPath)
+	}
+
+	sources := make([]*hostSource, 0, len(paths))
+	for _, p := range paths {
+		src := &hostSource{path: p, name: sourceName(p)}
+		if isRemoteHostFile(p) && ls.cacheDir != "" {
+			sum := sha256.Sum256([]byte(p))
+			src.cache = filepath.Join(ls.cacheDir, "m17-hostfile-"+hex.EncodeToString(sum[:8])+".json")
+		}
+		sources = append(sources, src)
+	}
+	return sources
+}
+
+// refresh reloads src and reports whether its contents changed.
+func (ls *ListStore) refresh(ctx context.Context, src *hostSource) bool {
+	var hf *hostfile
+	var err error
+	if isRemoteHostFile(src.path) {
+		hf, err = ls.fetchHostFile(ctx, src)
+	} else {
+		var modTime time.Time
+		hf, modTime, err = loadHostFile(ctx, src.path, src.modTime)
+		if err == nil {
+			src.modTime = modTime
+		}
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	ls.recordFetch(src, err)
+	if err != nil {
+		log.Error("Error loading host file", "err", err, "path", src.name)
+		hf = ls.loadFallback(src)
+	}
+	if hf == nil {
+		return false
+	}
+
+	ls.mu.Lock()
+	src.data = hf
+	ls.mu.Unlock()
+	return true
+}
+
+// fetchHostFile downloads a remote host file, returning nil without an
+// error if it has not changed since the last download.
+func (ls *ListStore) fetchHostFile(ctx context.Context, src *hostSource) (*hostfile, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if src.etag != "" {
+		req.Header.Set("If-None-Match", src.etag)
+	}
+	if src.lastModified != "" {
+		req.Header.Set("If-Modified-Since", src.lastModified)
+	}
+
+	resp, err := ls.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxHostFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxHostFileSize {
+		return nil, fmt.Errorf("host file larger than %d bytes", maxHostFileSize)
+	}
+	var hf hostfile
+	if err := json.Unmarshal(data, &hf); err != nil {
+		return nil, err
+	}
+
+	src.etag = resp.Header.Get("ETag")
+	src.lastModified = resp.Header.Get("Last-Modified")
+	if err := saveCache(src.cache, data); err != nil {
+		log.Warn("Failed to save host file copy", "err", err, "path", src.cache)
+	}
+	return &hf, nil
+}
+
+// saveCache replaces the copy on disk without leaving a partial file
+// behind if it fails.
+func saveCache(path string, data []byte) error {
+	if path == "" {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".m17-hostfile*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadFallback returns the copy on disk of a remote host file that has
+// not been loaded since startup. Once it has, the copy in memory is kept.
+func (ls *ListStore) loadFallback(src *hostSource) *hostfile {
+	if src.cache == "" {
+		return nil
+	}
+	ls.mu.RLock()
+	loaded := src.data != nil
+	ls.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	hf, modTime, err := loadHostFile(context.Background(), src.cache, time.Time{})
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warn("Failed to load host file copy", "err", err, "path", src.cache)
+		}
+		return nil
+	}
+	log.Info("Using saved host file copy", "source", src.name, "saved", modTime)
+
+	ls.mu.Lock()
+	src.dataTime = modTime
+	src.fallback = true
+	ls.mu.Unlock()
+	return hf
+}
+
+func (ls *ListStore) recordFetch(src *hostSource, err error) {
+	now := time.Now()
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	src.lastAttempt = now
+	src.fetchErr = err
+	if err == nil {
+		src.lastSuccess = now
+		src.dataTime = now
+		src.fallback = false
+	}
+}
+
+// mergeHostFiles merges the reflectors of all loaded sources by
+// designator. Fields set by a later source replace those of earlier ones;
+// a source's Remove list is applied before its own reflectors, so it can
+// also replace an entry outright.
+func mergeHostFiles(sources []*hostSource) []mergedReflector {
+	type entry struct {
+		fields  map[string]json.RawMessage
+		sources []string
+	}
+	var order []string
+	entries := make(map[string]*entry)
+
+	for _, src := range sources {
+		if src.data == nil {
+			continue
+		}
+		for _, d := range src.data.Remove {
+			delete(entries, strings.ToUpper(strings.TrimSpace(d)))
+		}
+		for _, fields := range src.data.Reflectors {
+			var designator string
+			if err := json.Unmarshal(fields["designator"], &designator); err != nil {
+				log.Warn("Ignoring host file entry without designator", "source", src.name)
+				continue
+			}
+			key := strings.ToUpper(strings.TrimSpace(designator))
+			if key == "" {
+				continue
+			}
+			e := entries[key]
+			if e == nil {
+				e = &entry{fields: make(map[string]json.RawMessage)}
+				entries[key] = e
+				order = append(order, key)
+			}
+			for k, v := range fields {
+				e.fields[k] = v
+			}
+			e.sources = append(e.sources, src.name)
+		}
+	}
+
+	var merged []mergedReflector
+	for _, key := range order {
+		e := entries[key]
+		if e == nil {
+			continue
+		}
+		// A key is in order twice if it was removed and added again.
+		entries[key] = nil
+
+		data, err := json.Marshal(e.fields)
+		if err != nil {
+			continue
+		}
+		var r mergedReflector
+		if err := json.Unmarshal(data, &r.hostfileReflector); err != nil {
+			log.Warn("Ignoring invalid host file entry", "err", err, "designator", key)
+			continue
+		}
+		r.sources = e.sources
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+func (ls *ListStore) HostFileStatus() []HostFileStatus {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	statuses := make([]HostFileStatus, 0, len(ls.sources))
+	for _, src := range ls.sources {
+		st := HostFileStatus{
+			Source:   src.name,
+			Fallback: src.fallback,
+		}
+		if src.data != nil {
+			st.Reflectors = len(src.data.Reflectors)
+		}
+		if !src.lastAttempt.IsZero() {
+			t := src.lastAttempt
+			st.LastAttempt = &t
+		}
+		if !src.lastSuccess.IsZero() {
+			t := src.lastSuccess
+			st.LastSuccess = &t
+		}
+		if !src.dataTime.IsZero() {
+			st.AgeSeconds = time.Since(src.dataTime).Seconds()
+		}
+		if src.fetchErr != nil {
+			st.Error = src.fetchErr.Error()
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses
+}
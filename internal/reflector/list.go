@@ -3,8 +3,8 @@ package reflector
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"sort"
 	"strings"
@@ -20,10 +20,23 @@ type ReflectorInfo struct {
 	Address    string `json:"address"`
 	Slug       string `json:"slug"`
 	Legacy     bool   `json:"legacy"`
+	// Sources names the host files the entry came from: the first added
+	// it, any later ones changed it.
+	Sources []string `json:"sources,omitempty"`
+
+	// Set by the Prober: Status is StatusOnline or StatusOffline, RTTMillis
+	// the ACKN round-trip time of the last successful probe.
+	Status    string     `json:"status,omitempty"`
+	LastSeen  *time.Time `json:"last_seen,omitempty"`
+	RTTMillis float64    `json:"rtt_ms,omitempty"`
 }
 
+// hostfile keeps each reflector as raw fields, so that a later source
+// only overrides the fields it sets. Remove lists designators to drop
+// from earlier sources.
 type hostfile struct {
-	Reflectors []hostfileReflector `json:"reflectors"`
+	Reflectors []map[string]json.RawMessage `json:"reflectors"`
+	Remove     []string                     `json:"remove"`
 }
 
 type hostfileReflector struct {
@@ -48,26 +61,41 @@ type cachedModules struct {
 type ListStore struct {
 	reflectorList []ReflectorInfo
 	designatorMap map[string]string
+	probes        map[string]probeResult
 	mu            sync.RWMutex
 
 	moduleCache map[string]cachedModules
 	moduleMu    sync.RWMutex
 
-	hostFilePath    string
-	hostFileModTime time.Time
+	// hostFilePath is a comma separated list of host files, local or
+	// remote, merged in order and followed by overridesPath.
+	hostFilePath  string
+	overridesPath string
+	sources       []*hostSource
+
+	// Remote host files are fetched with httpClient and saved to cacheDir
+	// for when they cannot be fetched at startup.
+	httpClient *http.Client
+	cacheDir   string
 }
 
 func NewListStore() *ListStore {
 	return &ListStore{
 		moduleCache: make(map[string]cachedModules),
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
 	}
 }
 
 func (ls *ListStore) Init() {
 	ls.hostFilePath = os.Getenv("M17_HOSTFILE")
-	if ls.hostFilePath == "" {
+	ls.overridesPath = os.Getenv("M17_HOSTFILE_OVERRIDES")
+	if ls.hostFilePath == "" && ls.overridesPath == "" {
 		log.Warn("M17_HOSTFILE not set; reflector list will be empty")
 	}
+	ls.cacheDir = os.Getenv("M17_HOSTFILE_CACHE_DIR")
+	if ls.cacheDir == "" {
+		ls.cacheDir = os.TempDir()
+	}
 }
 
 func loadHostFile(ctx context.Context, path string, modTime time.Time) (*hostfile, time.Time, error) {
@@ -97,18 +125,26 @@ func loadHostFile(ctx context.Context, path string, modTime time.Time) (*hostfil
 }
 
 func (ls *ListStore) FetchReflectors(ctx context.Context) {
-	if ls.hostFilePath == "" || ctx.Err() != nil {
+	if ctx.Err() != nil {
 		return
 	}
+	if ls.sources == nil {
+		sources := ls.newSources()
+		ls.mu.Lock()
+		ls.sources = sources
+		ls.mu.Unlock()
+	}
 
-	hf, modTime, err := loadHostFile(ctx, ls.hostFilePath, ls.hostFileModTime)
-	if err != nil {
-		if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
-			log.Error("Error loading host file", "err", err, "path", ls.hostFilePath)
+	changed := false
+	for _, src := range ls.sources {
+		if ls.refresh(ctx, src) {
+			changed = true
+		}
+		if ctx.Err() != nil {
+			return
 		}
-		return
 	}
-	if hf == nil {
+	if !changed {
 		return
 	}
 
@@ -116,7 +152,7 @@ func (ls *ListStore) FetchReflectors(ctx context.Context) {
 	newModuleCache := make(map[string]cachedModules)
 	newDesignatorMap := make(map[string]string)
 
-	for _, r := range hf.Reflectors {
+	for _, r := range mergeHostFiles(ls.sources) {
 		host := r.IPv4
 		if host == "" {
 			host = r.Domain
@@ -136,6 +172,7 @@ func (ls *ListStore) FetchReflectors(ctx context.Context) {
 			Address:    addr,
 			Slug:       slug,
 			Legacy:     r.Legacy,
+			Sources:    r.sources,
 		})
 
 		newDesignatorMap[addr] = r.Designator
@@ -167,7 +204,6 @@ func (ls *ListStore) FetchReflectors(ctx context.Context) {
 	ls.moduleCache = newModuleCache
 	ls.moduleMu.Unlock()
 
-	ls.hostFileModTime = modTime
 	log.Info("Updated reflector list", "count", len(list))
 }
 
@@ -184,7 +220,11 @@ func (ls *ListStore) FetchModules(slug string) []string {
 func (ls *ListStore) GetReflectors() []ReflectorInfo {
 	ls.mu.RLock()
 	defer ls.mu.RUnlock()
-	return append([]ReflectorInfo(nil), ls.reflectorList...)
+	list := append([]ReflectorInfo(nil), ls.reflectorList...)
+	for i := range list {
+		ls.applyProbe(&list[i])
+	}
+	return list
 }
 
 func (ls *ListStore) LookupDesignator(addr string) string {
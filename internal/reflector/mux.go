@@ -0,0 +1,152 @@
+package reflector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	log "github.com/kc1awv/m17-webclient/internal/logger"
+)
+
+// errAddrInUse is returned by Mux.register when another client already
+// talks to the same reflector address over the shared socket. Reflectors
+// tell clients apart by source address, so there can only be one.
+var errAddrInUse = errors.New("reflector address already in use on the shared socket")
+
+// Mux sends and receives for many reflector clients over one UDP socket
+// per address family, bound to the same port, and hands each incoming
+// datagram to the client connected to its source address.
+type Mux struct {
+	conns map[string]*net.UDPConn
+
+	mu      sync.Mutex
+	clients map[string]*ReflectorClient
+}
+
+// ListenMux binds port for IPv4 and IPv6. It only fails if neither
+// family can be bound.
+func ListenMux(port int) (*Mux, error) {
+	m := &Mux{
+		conns:   make(map[string]*net.UDPConn),
+		clients: make(map[string]*ReflectorClient),
+	}
+	var errs []error
+	for _, network := range []string{"udp4", "udp6"} {
+		conn, err := net.ListenUDP(network, &net.UDPAddr{Port: port})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		m.conns[network] = conn
+	}
+	if len(m.conns) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	for _, err := range errs {
+		log.Warn("Reflector socket unavailable", "err", err)
+	}
+	for _, conn := range m.conns {
+		go m.serve(conn)
+	}
+	return m, nil
+}
+
+func (m *Mux) NewReflectorClient(ctx context.Context, reflectorAddr, callsign string, module byte) (*ReflectorClient, error) {
+	return newReflectorClient(ctx, reflectorAddr, callsign, module, false, m)
+}
+
+func (m *Mux) NewListenClient(ctx context.Context, reflectorAddr, callsign string, module byte) (*ReflectorClient, error) {
+	return newReflectorClient(ctx, reflectorAddr, callsign, module, true, m)
+}
+
+// LocalAddr returns the address of the socket for network, "udp4" or
+// "udp6", or nil if it is not bound.
+func (m *Mux) LocalAddr(network string) net.Addr {
+	conn := m.conns[network]
+	if conn == nil {
+		return nil
+	}
+	return conn.LocalAddr()
+}
+
+func (m *Mux) Close() error {
+	var errs []error
+	for _, conn := range m.conns {
+		errs = append(errs, conn.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Mux) register(network string, c *ReflectorClient) error {
+	conn := m.conns[network]
+	if conn == nil {
+		return fmt.Errorf("no %s reflector socket", network)
+	}
+	key := c.Addr().String()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.clients[key]; ok {
+		return errAddrInUse
+	}
+	c.UDPConn = conn
+	c.mux = m
+	m.clients[key] = c
+	return nil
+}
+
+func (m *Mux) unregister(c *ReflectorClient) {
+	key := c.Addr().String()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.clients[key] == c {
+		delete(m.clients, key)
+	}
+}
+
+// move re-keys c after its reflector address changed from old.
+func (m *Mux) move(c *ReflectorClient, old *net.UDPAddr) error {
+	oldKey, key := old.String(), c.Addr().String()
+	if oldKey == key {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if other, ok := m.clients[key]; ok && other != c {
+		return errAddrInUse
+	}
+	if m.clients[oldKey] == c {
+		delete(m.clients, oldKey)
+	}
+	m.clients[key] = c
+	return nil
+}
+
+func (m *Mux) serve(conn *net.UDPConn) {
+	buf := make([]byte, maxDatagramSize)
+
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Error("UDP read error", "err", err, "local", conn.LocalAddr().String())
+			continue
+		}
+
+		m.mu.Lock()
+		c := m.clients[addr.String()]
+		m.mu.Unlock()
+		if c == nil {
+			log.Warn("Ignoring packet from unexpected source", "source", addr.String(), "local", conn.LocalAddr().String())
+			continue
+		}
+
+		c.handleDatagram(append([]byte(nil), buf[:n]...))
+	}
+}
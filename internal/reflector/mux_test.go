@@ -0,0 +1,166 @@
+package reflector
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kc1awv/m17-webclient/internal/m17"
+)
+
+func listenLoopback(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readConnect reads the client's CONN and returns where it came from.
+func readConnect(t *testing.T, server *net.UDPConn) *net.UDPAddr {
+	t.Helper()
+	buf := make([]byte, 256)
+	if err := server.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+	_, addr, err := server.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("no CONN from client: %v", err)
+	}
+	return addr
+}
+
+func TestMuxDemultiplexesByReflector(t *testing.T) {
+	mux, err := ListenMux(0)
+	if err != nil {
+		t.Fatalf("ListenMux: %v", err)
+	}
+	defer mux.Close()
+
+	serverA, serverB := listenLoopback(t), listenLoopback(t)
+	a, err := mux.NewReflectorClient(context.Background(), serverA.LocalAddr().String(), "TEST", 'A')
+	if err != nil {
+		t.Fatalf("client A: %v", err)
+	}
+	defer a.Close()
+	b, err := mux.NewListenClient(context.Background(), serverB.LocalAddr().String(), "TEST", 'B')
+	if err != nil {
+		t.Fatalf("client B: %v", err)
+	}
+	defer b.Close()
+
+	fromA, fromB := readConnect(t, serverA), readConnect(t, serverB)
+	port := mux.LocalAddr("udp4").(*net.UDPAddr).Port
+	if fromA.Port != port || fromB.Port != port {
+		t.Fatalf("clients sent from ports %d and %d, want shared port %d", fromA.Port, fromB.Port, port)
+	}
+
+	if _, err := serverA.WriteToUDP([]byte("M17 A"), fromA); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if _, err := serverB.WriteToUDP([]byte("M17 B"), fromB); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	for _, tc := range []struct {
+		client *ReflectorClient
+		want   string
+	}{{a, "M17 A"}, {b, "M17 B"}} {
+		select {
+		case got := <-tc.client.Packets:
+			if string(got) != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("packet %q not delivered", tc.want)
+		}
+	}
+
+	stranger := listenLoopback(t)
+	if _, err := stranger.WriteToUDP([]byte("M17 X"), fromA); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	select {
+	case got := <-a.Packets:
+		t.Fatalf("packet from unexpected source delivered: %q", got)
+	case got := <-b.Packets:
+		t.Fatalf("packet from unexpected source delivered: %q", got)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestMuxSecondClientToSameReflector(t *testing.T) {
+	mux, err := ListenMux(0)
+	if err != nil {
+		t.Fatalf("ListenMux: %v", err)
+	}
+	defer mux.Close()
+
+	server := listenLoopback(t)
+	first, err := mux.NewReflectorClient(context.Background(), server.LocalAddr().String(), "TEST", 'A')
+	if err != nil {
+		t.Fatalf("first client: %v", err)
+	}
+	second, err := mux.NewReflectorClient(context.Background(), server.LocalAddr().String(), "TEST", 'B')
+	if err != nil {
+		t.Fatalf("second client: %v", err)
+	}
+	defer second.Close()
+
+	if first.Conn() == second.Conn() {
+		t.Fatalf("second client shares the socket of the first")
+	}
+
+	first.Close()
+	select {
+	case _, ok := <-first.Packets:
+		if ok {
+			t.Fatalf("unexpected packet after Close")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Packets not closed")
+	}
+
+	third, err := mux.NewReflectorClient(context.Background(), server.LocalAddr().String(), "TEST", 'C')
+	if err != nil {
+		t.Fatalf("third client: %v", err)
+	}
+	defer third.Close()
+	if third.mux != mux {
+		t.Fatalf("client after Close did not get the shared socket")
+	}
+}
+
+func TestMuxDeliversMaxLengthPacket(t *testing.T) {
+	mux, err := ListenMux(0)
+	if err != nil {
+		t.Fatalf("ListenMux: %v", err)
+	}
+	defer mux.Close()
+
+	server := listenLoopback(t)
+	client, err := mux.NewReflectorClient(context.Background(), server.LocalAddr().String(), "TEST", 'A')
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	defer client.Close()
+
+	pkt, err := m17.BuildSMS("TEST", "N0CALL", 0, strings.Repeat("x", m17.MaxSMSLength))
+	if err != nil {
+		t.Fatalf("BuildSMS: %v", err)
+	}
+	if _, err := server.WriteToUDP(pkt, readConnect(t, server)); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	select {
+	case got := <-client.DataPackets:
+		if string(got) != string(pkt) {
+			t.Fatalf("got %d bytes, want the %d byte packet", len(got), len(pkt))
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("packet not delivered")
+	}
+}
@@ -0,0 +1,159 @@
+package reflector
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/kc1awv/m17-webclient/internal/logger"
+)
+
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+)
+
+var errProbeTimeout = errors.New("no ACKN from reflector")
+
+type probeResult struct {
+	online   bool
+	lastSeen time.Time
+	rtt      time.Duration
+}
+
+// Prober periodically connects to every reflector in a ListStore with a
+// throwaway callsign and records whether it answered and how long the
+// ACKN took. Connect defaults to NewListenClient; use NewReflectorClient
+// for reflectors that do not accept LSTN, the client's DISC ends the
+// connection either way.
+type Prober struct {
+	Store       *ListStore
+	Connect     func(ctx context.Context, addr, callsign string, module byte) (*ReflectorClient, error)
+	Interval    time.Duration
+	Timeout     time.Duration
+	Concurrency int
+}
+
+func NewProber(store *ListStore) *Prober {
+	return &Prober{
+		Store:       store,
+		Connect:     NewListenClient,
+		Interval:    5 * time.Minute,
+		Timeout:     3 * time.Second,
+		Concurrency: 8,
+	}
+}
+
+func (p *Prober) Start(ctx context.Context) {
+	go func() {
+		p.ProbeAll(ctx)
+		ticker := time.NewTicker(p.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.ProbeAll(ctx)
+			}
+		}
+	}()
+}
+
+func (p *Prober) ProbeAll(ctx context.Context) {
+	sem := make(chan struct{}, max(p.Concurrency, 1))
+	var wg sync.WaitGroup
+	for _, r := range p.Store.GetReflectors() {
+		module := byte('A')
+		if mods := p.Store.FetchModules(r.Slug); len(mods) > 0 {
+			module = mods[0][0]
+		}
+
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			rtt, err := p.Probe(ctx, addr, module)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Debug("Reflector probe failed", "err", err, "reflector", r.Designator)
+			}
+			p.Store.recordProbe(addr, rtt, err)
+		}(r.Address)
+	}
+	wg.Wait()
+}
+
+// Probe connects to the reflector at addr and returns the time until it
+// answered. A NACK counts as an answer: the reflector is up, it only
+// refused the callsign or module.
+func (p *Prober) Probe(ctx context.Context, addr string, module byte) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	c, err := p.Connect(ctx, addr, probeCallsign(), module)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	select {
+	case <-c.ackn:
+		return time.Since(start), nil
+	case <-c.Done():
+		if ctx.Err() != nil {
+			return 0, errProbeTimeout
+		}
+		return time.Since(start), nil
+	}
+}
+
+func probeCallsign() string {
+	var b [2]byte
+	_, _ = rand.Read(b[:])
+	return fmt.Sprintf("PROBE%02X%02X", b[0], b[1])
+}
+
+func (ls *ListStore) recordProbe(addr string, rtt time.Duration, err error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if ls.probes == nil {
+		ls.probes = make(map[string]probeResult)
+	}
+	res := ls.probes[addr]
+	res.online = err == nil
+	res.rtt = rtt
+	if err == nil {
+		res.lastSeen = time.Now()
+	}
+	ls.probes[addr] = res
+}
+
+// applyProbe fills in the probe result for r, if there is one.
+func (ls *ListStore) applyProbe(r *ReflectorInfo) {
+	res, ok := ls.probes[r.Address]
+	if !ok {
+		return
+	}
+	r.Status = StatusOffline
+	if res.online {
+		r.Status = StatusOnline
+		r.RTTMillis = float64(res.rtt.Microseconds()) / 1000
+	}
+	if !res.lastSeen.IsZero() {
+		lastSeen := res.lastSeen
+		r.LastSeen = &lastSeen
+	}
+}
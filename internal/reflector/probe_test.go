@@ -0,0 +1,66 @@
+package reflector
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kc1awv/m17-webclient/internal/m17"
+)
+
+// fakeReflector answers every LSTN or CONN with ACKN when ack is set.
+func fakeReflector(t *testing.T, ack bool) *net.UDPConn {
+	t.Helper()
+	conn := listenLoopback(t)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			typ, _, _, err := m17.ParseControlPacket(buf[:n])
+			if err == nil && ack && (typ == m17.CtrlLSTN || typ == m17.CtrlCONN) {
+				_, _ = conn.WriteToUDP([]byte(m17.MagicACKN), addr)
+			}
+		}
+	}()
+	return conn
+}
+
+func TestProberRecordsStatus(t *testing.T) {
+	up, down := fakeReflector(t, true), fakeReflector(t, false)
+
+	ls := NewListStore()
+	ls.reflectorList = []ReflectorInfo{
+		{Designator: "M17-DWN", Address: down.LocalAddr().String(), Slug: "m17-dwn"},
+		{Designator: "M17-UP", Address: up.LocalAddr().String(), Slug: "m17-up"},
+	}
+
+	p := NewProber(ls)
+	p.Timeout = 200 * time.Millisecond
+	p.ProbeAll(context.Background())
+
+	ls.mu.Lock()
+	ls.reflectorList = append(ls.reflectorList, ReflectorInfo{Designator: "M17-NEW", Address: "127.0.0.1:17000", Slug: "m17-new"})
+	ls.mu.Unlock()
+
+	list := ls.GetReflectors()
+	if list[0].Status != StatusOffline || list[0].LastSeen != nil || list[0].RTTMillis != 0 {
+		t.Fatalf("silent reflector = %+v; want offline, never seen", list[0])
+	}
+	if list[1].Status != StatusOnline || list[1].LastSeen == nil || list[1].RTTMillis <= 0 {
+		t.Fatalf("answering reflector = %+v; want online with RTT", list[1])
+	}
+	if list[2].Status != "" {
+		t.Fatalf("unprobed reflector status = %q; want empty", list[2].Status)
+	}
+
+	seen := *list[1].LastSeen
+	ls.recordProbe(up.LocalAddr().String(), 0, errProbeTimeout)
+	list = ls.GetReflectors()
+	if list[1].Status != StatusOffline || list[1].LastSeen == nil || !list[1].LastSeen.Equal(seen) {
+		t.Fatalf("reflector gone offline = %+v; want offline, last seen %v", list[1], seen)
+	}
+}
@@ -27,10 +27,31 @@ var (
 		Name: "m17_audio_frames_dropped_total",
 		Help: "Total number of audio frames dropped.",
 	})
+	rxFramesLost = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "m17_rx_frames_lost_total",
+		Help: "Total number of incoming stream frames missing from a frame number sequence.",
+	})
+	rxFramesDuplicate = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "m17_rx_frames_duplicate_total",
+		Help: "Total number of duplicate incoming stream frames discarded.",
+	})
+	rxFramesOutOfOrder = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "m17_rx_frames_out_of_order_total",
+		Help: "Total number of incoming stream frames discarded for arriving after a later frame.",
+	})
+	rxFramesConcealed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "m17_rx_frames_concealed_total",
+		Help: "Total number of concealment audio frames inserted for lost frames.",
+	})
+	streamContention = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "m17_stream_contention_total",
+		Help: "Total number of incoming streams ignored because another stream was already being received.",
+	})
 )
 
 func init() {
-	prometheus.MustRegister(sessionsStarted, sessionsEnded, pttEvents, heartbeats, activeSessions, audioFramesDropped)
+	prometheus.MustRegister(sessionsStarted, sessionsEnded, pttEvents, heartbeats, activeSessions, audioFramesDropped,
+		rxFramesLost, rxFramesDuplicate, rxFramesOutOfOrder, rxFramesConcealed, streamContention)
 }
 
 func RecordSessionStarted() {
@@ -55,3 +76,23 @@ func RecordHeartbeat(sessionCount int) {
 func RecordAudioFrameDropped() {
 	audioFramesDropped.Inc()
 }
+
+func RecordFramesLost(n int) {
+	rxFramesLost.Add(float64(n))
+}
+
+func RecordFrameDuplicate() {
+	rxFramesDuplicate.Inc()
+}
+
+func RecordFrameOutOfOrder() {
+	rxFramesOutOfOrder.Inc()
+}
+
+func RecordFramesConcealed(n int) {
+	rxFramesConcealed.Add(float64(n))
+}
+
+func RecordStreamContention() {
+	streamContention.Inc()
+}
@@ -0,0 +1,73 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/kc1awv/m17-webclient/internal/logger"
+	"github.com/kc1awv/m17-webclient/internal/m17/rf"
+)
+
+// basebandRecorder modulates the stream packets a session transmits and
+// writes them as 48 kHz baseband to a WAV file in dir. The file is created
+// with the first packet, so sessions that never transmit leave none.
+type basebandRecorder struct {
+	dir     string
+	session string
+
+	f   *os.File
+	bw  *rf.BasebandWriter
+	mod *rf.Modulator
+	err error
+}
+
+func newBasebandRecorder(dir, session string) *basebandRecorder {
+	return &basebandRecorder{dir: dir, session: session}
+}
+
+func (r *basebandRecorder) open() error {
+	name := fmt.Sprintf("%s-%s.wav", time.Now().UTC().Format("20060102-150405"), r.session)
+	f, err := os.Create(filepath.Join(r.dir, name))
+	if err != nil {
+		return err
+	}
+	bw, err := rf.NewBasebandWriter(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.bw, r.mod = f, bw, rf.NewModulator(bw)
+	log.Info("Recording transmitted baseband", "session", r.session, "path", f.Name())
+	return nil
+}
+
+// write is the stream handler tap. After the first error the rest of the
+// transmission is dropped; sending to the reflector is not affected.
+func (r *basebandRecorder) write(pkt []byte) {
+	if r.err != nil {
+		return
+	}
+	if r.mod == nil {
+		r.err = r.open()
+	}
+	if r.err == nil {
+		r.err = r.mod.WritePacket(pkt)
+	}
+	if r.err != nil {
+		log.Warn("Failed to record transmitted baseband", "session", r.session, "err", r.err)
+	}
+}
+
+// Close ends an unfinished transmission with EOT and completes the WAV
+// header.
+func (r *basebandRecorder) Close() error {
+	if r.f == nil {
+		return nil
+	}
+	err := errors.Join(r.mod.Close(), r.bw.Close(), r.f.Close())
+	r.f, r.bw, r.mod = nil, nil, nil
+	return err
+}
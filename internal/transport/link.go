@@ -0,0 +1,304 @@
+package transport
+
+import (
+	"context"
+	"sync"
+
+	log "github.com/kc1awv/m17-webclient/internal/logger"
+	"github.com/kc1awv/m17-webclient/internal/m17"
+	"github.com/kc1awv/m17-webclient/internal/reflector"
+)
+
+// linkCacheSize is how many decoded frames a link keeps for its
+// subscribers, enough to cover a full subscriber packet queue.
+const linkCacheSize = 128
+
+// LinkManager shares one reflector connection per reflector module among
+// all sessions joined to it. Each link connects with Callsign, decodes
+// every frame once and fans the packets out to its sessions, which only
+// convert the audio to their own format. One session at a time may
+// transmit on a link. Listen-only sessions get links of their own,
+// connected with NewListenClient.
+type LinkManager struct {
+	Callsign           string
+	NewReflectorClient func(ctx context.Context, addr, callsign string, module byte) (*reflector.ReflectorClient, error)
+	NewListenClient    func(ctx context.Context, addr, callsign string, module byte) (*reflector.ReflectorClient, error)
+
+	mu    sync.Mutex
+	links map[linkKey]*Link
+}
+
+type linkKey struct {
+	reflector  string
+	module     byte
+	listenOnly bool
+}
+
+type Link struct {
+	key     linkKey
+	manager *LinkManager
+	client  *reflector.ReflectorClient
+	decoder *m17.StreamHandler
+
+	mu      sync.Mutex
+	subs    map[*Session]*linkSub
+	txOwner *Session
+	cache   [linkCacheSize]decodedFrame
+	next    int
+}
+
+type decodedFrame struct {
+	streamID uint16
+	frameNum uint16
+	valid    bool
+	pcm      []byte
+}
+
+// linkSub is a session's subscription to a link.
+type linkSub struct {
+	link        *Link
+	packets     chan []byte
+	dataPackets chan []byte
+	onEvent     func(reflector.Event)
+}
+
+func NewLinkManager(callsign string) *LinkManager {
+	return &LinkManager{
+		Callsign:           callsign,
+		NewReflectorClient: reflector.NewReflectorClient,
+		NewListenClient:    reflector.NewListenClient,
+		links:              make(map[linkKey]*Link),
+	}
+}
+
+// Subscribe joins s to the link for the reflector module, connecting it if
+// s is the first session. Listen-only sessions share a separate link
+// connected with LSTN. onEvent receives the link's reflector events.
+// The connection is made without holding the manager lock, so sessions on
+// other links are not held up by a slow reflector.
+func (m *LinkManager) Subscribe(s *Session, addr string, module byte, listenOnly bool, onEvent func(reflector.Event)) (*linkSub, error) {
+	key := linkKey{reflector: addr, module: module, listenOnly: listenOnly}
+	m.mu.Lock()
+	if l, ok := m.links[key]; ok {
+		defer m.mu.Unlock()
+		return l.subscribe(s, onEvent), nil
+	}
+	m.mu.Unlock()
+
+	connect := m.NewReflectorClient
+	if listenOnly {
+		connect = m.NewListenClient
+	}
+	rc, err := connect(context.Background(), addr, m.Callsign, module)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := m17.NewStreamHandler(nil, nil, m.Callsign, "", 0, m17.StreamModeVoice)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l, ok := m.links[key]; ok {
+		// Another session connected the link first.
+		decoder.Close()
+		rc.Close()
+		return l.subscribe(s, onEvent), nil
+	}
+	l := &Link{key: key, manager: m, client: rc, decoder: decoder, subs: make(map[*Session]*linkSub)}
+	m.links[key] = l
+	go l.run()
+	log.Info("Reflector link connected", "reflector", addr, "module", string(module), "listen_only", listenOnly)
+	return l.subscribe(s, onEvent), nil
+}
+
+func (l *Link) subscribe(s *Session, onEvent func(reflector.Event)) *linkSub {
+	sub := &linkSub{
+		link:        l,
+		packets:     make(chan []byte, OutgoingAudioBufSize),
+		dataPackets: make(chan []byte, 10),
+		onEvent:     onEvent,
+	}
+	l.mu.Lock()
+	l.subs[s] = sub
+	l.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe removes s from its link, releasing the transmitter if s held
+// it, and closes the link once no session is left.
+func (m *LinkManager) Unsubscribe(s *Session, sub *linkSub) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l := sub.link
+	l.mu.Lock()
+	if _, ok := l.subs[s]; ok {
+		delete(l.subs, s)
+		close(sub.packets)
+		close(sub.dataPackets)
+	}
+	if l.txOwner == s {
+		l.txOwner = nil
+	}
+	empty := len(l.subs) == 0
+	l.mu.Unlock()
+
+	if empty && m.links[l.key] == l {
+		delete(m.links, l.key)
+		l.client.Close()
+		log.Info("Reflector link closed", "reflector", l.key.reflector, "module", string(l.key.module))
+	}
+}
+
+// Count returns the number of open links.
+func (m *LinkManager) Count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.links)
+}
+
+func (l *Link) run() {
+	defer l.decoder.Close()
+	defer l.shutdown()
+
+	packets, dataPackets, events := l.client.Packets, l.client.DataPackets, l.client.Events
+	for {
+		select {
+		case pkt, ok := <-packets:
+			if !ok {
+				return
+			}
+			l.decode(pkt)
+			l.fanOut(nil, pkt, false)
+		case pkt, ok := <-dataPackets:
+			if !ok {
+				dataPackets = nil
+				continue
+			}
+			l.fanOut(nil, pkt, true)
+		case evt, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			l.mu.Lock()
+			subs := make([]*linkSub, 0, len(l.subs))
+			for _, sub := range l.subs {
+				subs = append(subs, sub)
+			}
+			l.mu.Unlock()
+			for _, sub := range subs {
+				sub.onEvent(evt)
+			}
+		case <-l.client.Done():
+			return
+		}
+	}
+}
+
+// shutdown drops a link whose reflector connection has ended; its sessions
+// see their packet channels close.
+func (l *Link) shutdown() {
+	m := l.manager
+	m.mu.Lock()
+	if m.links[l.key] == l {
+		delete(m.links, l.key)
+	}
+	m.mu.Unlock()
+
+	l.mu.Lock()
+	for s, sub := range l.subs {
+		delete(l.subs, s)
+		close(sub.packets)
+		close(sub.dataPackets)
+	}
+	l.txOwner = nil
+	l.mu.Unlock()
+}
+
+// decode decodes a stream frame once for all subscribers. Frames the link
+// cannot decode, such as encrypted ones, are left to each session.
+func (l *Link) decode(pkt []byte) {
+	spkt, err := m17.ParseStreamPacket(pkt)
+	if err != nil {
+		return
+	}
+	pcm, err := l.decoder.HandleIncomingPacket(pkt, true)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	l.cache[l.next] = decodedFrame{streamID: spkt.StreamID, frameNum: spkt.FrameNum, valid: true, pcm: pcm}
+	l.next = (l.next + 1) % linkCacheSize
+	l.mu.Unlock()
+}
+
+// decoded returns the PCM of a frame decoded by the link. The slice is
+// shared between sessions and must not be modified.
+func (l *Link) decoded(streamID, frameNum uint16) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := range l.cache {
+		f := &l.cache[i]
+		if f.valid && f.streamID == streamID && f.frameNum == frameNum {
+			return f.pcm, true
+		}
+	}
+	return nil, false
+}
+
+func (l *Link) fanOut(from *Session, pkt []byte, data bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for s, sub := range l.subs {
+		if s == from {
+			continue
+		}
+		ch := sub.packets
+		if data {
+			ch = sub.dataPackets
+		}
+		select {
+		case ch <- pkt:
+		default:
+			log.Warn("Link subscriber queue full, dropping packet", "session", s.ID, "reflector", l.key.reflector)
+		}
+	}
+}
+
+// loopback passes a stream transmitted by s to the link's other sessions,
+// since the reflector does not send it back to the link.
+func (l *Link) loopback(s *Session, pkt []byte) {
+	pkt = append([]byte(nil), pkt...)
+	l.decode(pkt)
+	l.fanOut(s, pkt, false)
+}
+
+// acquireTX makes s the link's transmitting session. It fails while
+// another session holds the transmitter.
+func (l *Link) acquireTX(s *Session) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.txOwner != nil && l.txOwner != s {
+		return false
+	}
+	l.txOwner = s
+	return true
+}
+
+func (l *Link) releaseTX(s *Session) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.txOwner == s {
+		l.txOwner = nil
+	}
+}
+
+func (l *Link) transmitting(s *Session) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.txOwner == s
+}
@@ -0,0 +1,254 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kc1awv/m17-webclient/internal/m17"
+	"github.com/kc1awv/m17-webclient/internal/reflector"
+)
+
+func newTestLinkManager(t *testing.T) (*LinkManager, chan *reflector.ReflectorClient) {
+	t.Helper()
+	created := make(chan *reflector.ReflectorClient, 4)
+	m := NewLinkManager("N0LINK")
+	m.NewReflectorClient = func(ctx context.Context, addr, callsign string, module byte) (*reflector.ReflectorClient, error) {
+		if callsign != "N0LINK" {
+			t.Errorf("link connected as %q, want N0LINK", callsign)
+		}
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		if err != nil {
+			return nil, err
+		}
+		rc := reflector.NewTestClient(ctx, conn, conn.LocalAddr().(*net.UDPAddr), callsign, module, "TEST", make(chan []byte, 10), nil)
+		created <- rc
+		return rc, nil
+	}
+	return m, created
+}
+
+func TestLinkManagerSharesLink(t *testing.T) {
+	m, created := newTestLinkManager(t)
+	a, b, c := &Session{ID: "a"}, &Session{ID: "b"}, &Session{ID: "c"}
+	noEvents := func(reflector.Event) {}
+
+	subA, err := m.Subscribe(a, "127.0.0.1:17000", 'A', false, noEvents)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	subB, err := m.Subscribe(b, "127.0.0.1:17000", 'A', false, noEvents)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	subC, err := m.Subscribe(c, "127.0.0.1:17000", 'B', false, noEvents)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if subA.link != subB.link || subA.link == subC.link || m.Count() != 2 {
+		t.Fatalf("expected sessions on module A to share a link, got %d links", m.Count())
+	}
+	rc := <-created
+
+	lsf, _ := m17.BuildLSF("M17-TEST A", "N0CALL", voiceStream, [14]byte{})
+	pkt, _ := m17.BuildStreamPacket(0x4242, m17.LSFToLSD(lsf), 0, false, [16]byte{})
+	rc.Packets <- pkt
+	for _, sub := range []*linkSub{subA, subB} {
+		select {
+		case <-sub.packets:
+		case <-time.After(time.Second):
+			t.Fatal("packet not fanned out to subscriber")
+		}
+	}
+	if _, ok := subA.link.decoded(0x4242, 0); !ok {
+		t.Error("frame not decoded by the link")
+	}
+	select {
+	case <-subC.packets:
+		t.Fatal("packet delivered to another module")
+	default:
+	}
+
+	m.Unsubscribe(a, subA)
+	select {
+	case <-rc.Done():
+		t.Fatal("link closed while a session is still subscribed")
+	default:
+	}
+	m.Unsubscribe(b, subB)
+	select {
+	case <-rc.Done():
+	case <-time.After(time.Second):
+		t.Fatal("link not closed after its last session left")
+	}
+	if m.Count() != 1 {
+		t.Fatalf("got %d links, want 1", m.Count())
+	}
+	m.Unsubscribe(c, subC)
+}
+
+func TestLinkPTTArbitration(t *testing.T) {
+	m, _ := newTestLinkManager(t)
+	a, b := &Session{ID: "a"}, &Session{ID: "b"}
+	subA, _ := m.Subscribe(a, "127.0.0.1:17000", 'A', false, func(reflector.Event) {})
+	subB, _ := m.Subscribe(b, "127.0.0.1:17000", 'A', false, func(reflector.Event) {})
+	l := subA.link
+
+	if !l.acquireTX(a) {
+		t.Fatal("first session could not transmit")
+	}
+	if l.acquireTX(b) {
+		t.Fatal("second session transmitted while the first holds the link")
+	}
+
+	// The transmission is looped back to the other sessions only.
+	lsf, _ := m17.BuildLSF("M17-TEST A", "N0CALL", voiceStream, [14]byte{})
+	pkt, _ := m17.BuildStreamPacket(0x1111, m17.LSFToLSD(lsf), 0, false, [16]byte{})
+	l.loopback(a, pkt)
+	if len(subA.packets) != 0 || len(subB.packets) != 1 {
+		t.Fatalf("loopback delivered %d/%d packets, want 0/1", len(subA.packets), len(subB.packets))
+	}
+
+	l.releaseTX(a)
+	if !l.acquireTX(b) {
+		t.Fatal("second session could not transmit after release")
+	}
+	m.Unsubscribe(b, subB)
+	if !l.acquireTX(a) {
+		t.Fatal("transmitter not released when its session left")
+	}
+	m.Unsubscribe(a, subA)
+}
+
+func TestLinkManagerListenOnlyLink(t *testing.T) {
+	m, _ := newTestLinkManager(t)
+	listened := make(chan string, 2)
+	connect := m.NewReflectorClient
+	m.NewListenClient = func(ctx context.Context, addr, callsign string, module byte) (*reflector.ReflectorClient, error) {
+		listened <- callsign
+		return connect(ctx, addr, callsign, module)
+	}
+	noEvents := func(reflector.Event) {}
+
+	tx, err := m.Subscribe(&Session{ID: "tx"}, "127.0.0.1:17000", 'A', false, noEvents)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	swl, err := m.Subscribe(&Session{ID: "swl", ListenOnly: true}, "127.0.0.1:17000", 'A', true, noEvents)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	swl2, err := m.Subscribe(&Session{ID: "swl2", ListenOnly: true}, "127.0.0.1:17000", 'A', true, noEvents)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if tx.link == swl.link || swl.link != swl2.link || m.Count() != 2 {
+		t.Fatalf("expected one transmitting and one listen-only link, got %d links", m.Count())
+	}
+	if len(listened) != 1 || <-listened != "N0LINK" {
+		t.Fatal("listen-only link not connected with LSTN as the link callsign")
+	}
+}
+
+func TestLinkManagerConnectsOutsideLock(t *testing.T) {
+	m, created := newTestLinkManager(t)
+	connect := m.NewReflectorClient
+	release := make(chan struct{})
+	var dialing sync.WaitGroup
+	dialing.Add(2)
+	m.NewReflectorClient = func(ctx context.Context, addr, callsign string, module byte) (*reflector.ReflectorClient, error) {
+		if module == 'A' {
+			dialing.Done()
+			<-release
+		}
+		return connect(ctx, addr, callsign, module)
+	}
+	noEvents := func(reflector.Event) {}
+
+	subs := make(chan *linkSub, 2)
+	for _, s := range []*Session{{ID: "a"}, {ID: "b"}} {
+		go func(s *Session) {
+			sub, err := m.Subscribe(s, "127.0.0.1:17000", 'A', false, noEvents)
+			if err != nil {
+				t.Errorf("Subscribe: %v", err)
+			}
+			subs <- sub
+		}(s)
+	}
+	dialing.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := m.Subscribe(&Session{ID: "c"}, "127.0.0.1:17000", 'B', false, noEvents); err != nil {
+			t.Errorf("Subscribe: %v", err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Subscribe to another link blocked by a pending connect")
+	}
+	<-created
+
+	close(release)
+	subA, subB := <-subs, <-subs
+	if subA.link != subB.link || m.Count() != 2 {
+		t.Fatalf("concurrent subscribers got separate links, %d links open", m.Count())
+	}
+	loser, other := <-created, <-created
+	if subA.link.client == loser {
+		loser = other
+	}
+	select {
+	case <-loser.Done():
+	case <-time.After(time.Second):
+		t.Fatal("losing connection not closed")
+	}
+}
+
+func TestDisconnectStopsLinkTransmit(t *testing.T) {
+	links, _ := newTestLinkManager(t)
+	manager := NewSessionManager()
+	cfg := WebSocketConfig{Links: links}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HandleWebSocket(manager, cfg, w, r)
+	}))
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": {srv.URL}})
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	expect := func(typ string) {
+		t.Helper()
+		var msg ServerMessage
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if err := conn.ReadJSON(&msg); err != nil || msg.Type != typ {
+			t.Fatalf("expected %s, got %v, err %v", typ, msg, err)
+		}
+	}
+	expect("welcome")
+	jb, _ := json.Marshal(map[string]string{"callsign": "N0CALL", "reflector": "127.0.0.1:17000", "module": "A"})
+	conn.WriteJSON(ClientMessage{Type: "join", Data: jb})
+	expect("joined")
+	conn.WriteJSON(ClientMessage{Type: "disconnect"})
+	expect("disconnected")
+
+	// Off the link, audio must not reach the reflector socket.
+	conn.WriteMessage(websocket.BinaryMessage, make([]byte, 160))
+	expect("error")
+	if links.Count() != 0 {
+		t.Fatalf("got %d links after the only session left, want 0", links.Count())
+	}
+}
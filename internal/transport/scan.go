@@ -0,0 +1,78 @@
+package transport
+
+import (
+	"context"
+
+	log "github.com/kc1awv/m17-webclient/internal/logger"
+	"github.com/kc1awv/m17-webclient/internal/reflector"
+)
+
+// maxScanChannels limits the listen-only links a session may scan.
+const maxScanChannels = 8
+
+// Scan policies decide what happens when a stream starts on one channel
+// while another channel is being received.
+const (
+	// ScanFirst stays on the channel that became active first.
+	ScanFirst = "first"
+	// ScanPriority lets a higher priority channel take over; the home
+	// module comes first, then the scanned channels in the order given.
+	ScanPriority = "priority"
+)
+
+// scanChannel is a reflector module a session receives from. The home
+// channel is the joined module, the only one transmitted on; the others
+// are listen-only links.
+type scanChannel struct {
+	Reflector string
+	Module    string
+	priority  int
+	client    *reflector.ReflectorClient
+	// link is set for a home module on a shared link.
+	link *Link
+}
+
+type scanPacket struct {
+	ch  *scanChannel
+	pkt []byte
+}
+
+// startScan connects a listen-only link for each channel and forwards its
+// stream packets to the receive loop. On error the links already made are
+// closed again.
+func (s *Session) startScan(ctx context.Context, channels []*scanChannel, newListenClient func(context.Context, string, string, byte) (*reflector.ReflectorClient, error)) error {
+	for _, ch := range channels {
+		rc, err := newListenClient(ctx, ch.Reflector, s.Callsign, ch.Module[0])
+		if err != nil {
+			for _, ch := range channels {
+				if ch.client != nil {
+					ch.client.Disconnect()
+				}
+			}
+			return err
+		}
+		ch.client = rc
+	}
+
+	in := s.scanIn
+	for _, ch := range channels {
+		go func(ch *scanChannel) {
+			for pkt := range ch.client.Packets {
+				select {
+				case in <- scanPacket{ch: ch, pkt: pkt}:
+				default:
+					log.Warn("Scan packet channel full, dropping stream packet", "session", s.ID, "reflector", ch.Reflector, "module", ch.Module)
+				}
+			}
+		}(ch)
+	}
+	s.scan = channels
+	return nil
+}
+
+func (s *Session) stopScan() {
+	for _, ch := range s.scan {
+		ch.client.Disconnect()
+	}
+	s.scan = nil
+}
@@ -1,15 +1,22 @@
 package transport
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/kc1awv/m17-webclient/internal/audio"
 	log "github.com/kc1awv/m17-webclient/internal/logger"
 	"github.com/kc1awv/m17-webclient/internal/m17"
+	"github.com/kc1awv/m17-webclient/internal/m17/rf"
 	"github.com/kc1awv/m17-webclient/internal/reflector"
 	"github.com/kc1awv/m17-webclient/internal/status"
 )
@@ -21,11 +28,52 @@ const (
 
 var reflectorTimeout = 2 * time.Second
 
+// maxConcealFrames caps the concealment audio inserted for a single gap;
+// longer gaps are not filled.
+const maxConcealFrames = 25
+
 type Session struct {
-	ID        string
-	Callsign  string
-	Reflector *reflector.ReflectorClient
-	Stream    *m17.StreamHandler
+	ID       string
+	Callsign string
+	// Destination overrides the reflector module as the transmit
+	// destination, e.g. @ALL or a #-prefixed address.
+	Destination string
+	CAN         uint8
+	Mode        m17.StreamMode
+	Position    *m17.GNSS
+	Text        string
+	Key         *m17.Key
+	// SigningKeys holds the private keys used to sign transmitted streams
+	// and PublicKeys the keys used to verify received ones. signer is the
+	// key unlocked by the signing token given at join, if any.
+	SigningKeys m17.KeyDir
+	PublicKeys  m17.KeyDir
+	signer      *ecdsa.PrivateKey
+	// BasebandDir, when set, receives a 48 kHz baseband WAV file of each
+	// stream handler's transmissions.
+	BasebandDir string
+	baseband    *basebandRecorder
+	// ListenOnly sessions are connected with LSTN and may not transmit.
+	ListenOnly bool
+	Reflector  *reflector.ReflectorClient
+	// Stream is replaced only by the session's own goroutine, under
+	// streamMu, so that reflector events may read it under streamMu.
+	Stream   *m17.StreamHandler
+	streamMu sync.Mutex
+
+	// joinReq is the join that connected Reflector, the base for a QSY.
+	// left is closed when Reflector is taken down on purpose.
+	joinReq *joinRequest
+	left    chan struct{}
+	// link is set when Reflector is a link shared with other sessions.
+	link *linkSub
+
+	// home is the joined module and scan the listen-only channels
+	// monitored alongside it, whose packets arrive on scanIn.
+	home        *scanChannel
+	scan        []*scanChannel
+	scanIn      chan scanPacket
+	scanPreempt atomic.Bool
 
 	OutgoingAudio    chan []byte
 	OutgoingMessages chan ServerMessage
@@ -34,6 +82,23 @@ type Session struct {
 
 	streamStop chan struct{}
 	streamWG   sync.WaitGroup
+
+	rxPosition *PositionMessage
+	rxECD      *m17.ECD
+	rxText     m17.TextAssembler
+	rxLastText string
+	rxSigned   bool
+	rxSource   string
+	rxVerifier m17.StreamVerifier
+
+	rxChannel   *scanChannel
+	rxTracking  bool
+	rxStreamID  uint16
+	rxNextFN    uint16
+	rxLastAudio []byte
+	// rxDoubling holds the competing streams already reported while
+	// locked onto rxStreamID.
+	rxDoubling map[uint16]bool
 }
 
 type SessionManager struct {
@@ -99,10 +164,11 @@ func cleanupSession(s *Session) error {
 			errs = append(errs, err)
 		}
 	}
-	if s.Reflector != nil {
-		if err := try("Reflector.Disconnect", s.Reflector.Disconnect); err != nil {
-			errs = append(errs, err)
-		}
+	if err := try("stopScan", s.stopScan); err != nil {
+		errs = append(errs, err)
+	}
+	if err := try("disconnectReflector", s.disconnectReflector); err != nil {
+		errs = append(errs, err)
 	}
 	if err := try("close OutgoingAudio", func() { close(s.OutgoingAudio) }); err != nil {
 		errs = append(errs, err)
@@ -141,32 +207,121 @@ func (s *Session) StartStreamHandler() error {
 	reflectorAddr := s.Reflector.Addr()
 
 	dstID := fmt.Sprintf("%s %c", s.Reflector.Designator, s.Reflector.Module)
-	handler, err := m17.NewStreamHandler(udpConn, reflectorAddr, s.Callsign, dstID)
+	if s.Destination != "" {
+		dstID = s.Destination
+	}
+	handler, err := m17.NewStreamHandler(udpConn, reflectorAddr, s.Callsign, dstID, s.CAN, s.Mode)
 	if err != nil {
 		return err
 	}
+	if err := handler.SetPosition(s.Position); err != nil {
+		handler.Close()
+		return err
+	}
+	if err := handler.SetText(s.Text); err != nil {
+		handler.Close()
+		return err
+	}
+	if err := handler.SetKey(s.Key); err != nil {
+		handler.Close()
+		return err
+	}
+	if err := handler.SetSigningKey(s.signer); err != nil {
+		handler.Close()
+		return err
+	}
 
-	s.Stream = handler
+	s.setStream(handler)
+
+	s.home = &scanChannel{Reflector: s.Reflector.Designator, Module: string(s.Reflector.Module)}
+	if s.joinReq != nil {
+		s.home.Reflector = s.joinReq.Reflector
+	}
+	var taps []func(pkt []byte)
+	if s.link != nil {
+		l := s.link.link
+		s.home.link = l
+		taps = append(taps, func(pkt []byte) { l.loopback(s, pkt) })
+	}
+	if s.BasebandDir != "" {
+		s.baseband = newBasebandRecorder(s.BasebandDir, s.ID)
+		taps = append(taps, s.baseband.write)
+	}
+	if len(taps) > 0 {
+		handler.SetTap(func(pkt []byte) {
+			for _, tap := range taps {
+				tap(pkt)
+			}
+		})
+	}
+	s.scanIn = make(chan scanPacket, OutgoingAudioBufSize)
 
-	s.streamStop = make(chan struct{})
+	stop := make(chan struct{})
+	s.streamStop = stop
 	s.streamWG.Add(1)
 	go func() {
 		defer s.streamWG.Done()
-		s.handleReflectorPackets(s.streamStop)
+		s.handleReflectorPackets(stop)
 	}()
 
 	return nil
 }
 
+// reattachReflector points the stream handler at the reflector again after
+// rc has reconnected, possibly to a newly resolved address.
+func (s *Session) reattachReflector(rc *reflector.ReflectorClient) {
+	s.streamMu.Lock()
+	defer s.streamMu.Unlock()
+	if s.Stream != nil {
+		s.Stream.SetReflector(rc.Conn(), rc.Addr())
+	}
+}
+
+func (s *Session) setStream(handler *m17.StreamHandler) {
+	s.streamMu.Lock()
+	s.Stream = handler
+	s.streamMu.Unlock()
+}
+
+// leaveReflector takes the session off its reflector: the stream handler is
+// stopped and DISC sent, without reporting the session as disconnected.
+func (s *Session) leaveReflector() {
+	s.stopScan()
+	s.StopStreamHandler()
+	if s.left != nil {
+		close(s.left)
+		s.left = nil
+	}
+	s.disconnectReflector()
+}
+
+// disconnectReflector sends DISC, or for a shared link leaves it.
+func (s *Session) disconnectReflector() {
+	switch {
+	case s.link != nil:
+		s.link.link.manager.Unsubscribe(s, s.link)
+		s.link = nil
+	case s.Reflector != nil:
+		s.Reflector.Disconnect()
+	}
+	s.Reflector = nil
+}
+
 func (s *Session) StopStreamHandler() {
 	if s.streamStop != nil {
 		close(s.streamStop)
 		s.streamStop = nil
 	}
 	s.streamWG.Wait()
-	if s.Stream != nil {
-		s.Stream.Close()
-		s.Stream = nil
+	if handler := s.Stream; handler != nil {
+		s.setStream(nil)
+		handler.Close()
+	}
+	if s.baseband != nil {
+		if err := s.baseband.Close(); err != nil {
+			log.Warn("Failed to finish baseband recording", "session", s.ID, "err", err)
+		}
+		s.baseband = nil
 	}
 }
 
@@ -189,7 +344,14 @@ func (s *Session) handleReflectorPackets(stop <-chan struct{}) {
 	if s.Reflector == nil {
 		return
 	}
+	packets, dataPackets := s.Reflector.Packets, s.Reflector.DataPackets
+	if s.link != nil {
+		packets, dataPackets = s.link.packets, s.link.dataPackets
+	}
+	s.handlePackets(packets, dataPackets, s.scanIn, s.Reflector.Done(), stop)
+}
 
+func (s *Session) handlePackets(packets, dataPackets <-chan []byte, scanned <-chan scanPacket, done, stop <-chan struct{}) {
 	timer := time.NewTimer(reflectorTimeout)
 	defer timer.Stop()
 
@@ -203,7 +365,7 @@ func (s *Session) handleReflectorPackets(stop <-chan struct{}) {
 				s.notifyRxInactive()
 			}
 			return
-		case pkt, ok := <-s.Reflector.Packets:
+		case pkt, ok := <-packets:
 			if !ok {
 				if rxActive {
 					rxActive = false
@@ -212,15 +374,29 @@ func (s *Session) handleReflectorPackets(stop <-chan struct{}) {
 				return
 			}
 
-			s.processPacket(pkt, &rxActive)
-			if rxActive {
+			if s.processPacket(pkt, &rxActive) && rxActive {
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(reflectorTimeout)
+			}
+
+		case sp := <-scanned:
+			if s.processChannelPacket(sp.ch, sp.pkt, &rxActive) && rxActive {
 				if !timer.Stop() {
 					<-timer.C
 				}
 				timer.Reset(reflectorTimeout)
 			}
 
-		case <-s.Reflector.Done():
+		case pkt, ok := <-dataPackets:
+			if !ok {
+				dataPackets = nil
+				continue
+			}
+			s.processDataPacket(pkt)
+
+		case <-done:
 			if rxActive {
 				rxActive = false
 				s.notifyRxInactive()
@@ -237,54 +413,374 @@ func (s *Session) handleReflectorPackets(stop <-chan struct{}) {
 	}
 }
 
-func (s *Session) notifyRxActive(src string) {
+// ReceiveRF demodulates 48 kHz M17 baseband from r, e.g. an RTL-SDR
+// capture, and passes the recovered stream packets through the same RX
+// path as reflector traffic. It returns once r is exhausted. The session
+// must not be connected to a reflector.
+func (s *Session) ReceiveRF(r io.Reader) error {
+	if s.Reflector != nil {
+		return fmt.Errorf("session is connected to a reflector")
+	}
+	if s.Stream == nil {
+		handler, err := m17.NewStreamHandler(nil, nil, s.Callsign, "", s.CAN, s.Mode)
+		if err != nil {
+			return err
+		}
+		s.setStream(handler)
+		defer func() {
+			s.setStream(nil)
+			handler.Close()
+		}()
+	}
+
+	packets := make(chan []byte, 10)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(packets)
+		errc <- rf.NewReceiver(packets).Run(r)
+	}()
+
+	s.handlePackets(packets, nil, nil, nil, nil)
+	return <-errc
+}
+
+func (s *Session) notifyRxActive(lsf *m17.LSF) {
+	can := lsf.Type.CAN
+	msg := RxStatusMessage{
+		Active:     true,
+		Src:        lsf.Source,
+		Dst:        lsf.Destination,
+		DataType:   lsf.Type.DataType.String(),
+		Encryption: lsf.Type.Encryption.String(),
+		NoKey:      !s.Stream.CanDecrypt(lsf.Type),
+		Signed:     lsf.Type.Signed,
+		CAN:        &can,
+		Position:   s.rxPosition,
+	}
+	if s.rxChannel != nil {
+		msg.Reflector = s.rxChannel.Reflector
+		msg.Module = s.rxChannel.Module
+	}
+	if s.rxECD != nil {
+		msg.Originator = s.rxECD.Originator
+		msg.Via = s.rxECD.Via
+	}
+	select {
+	case s.OutgoingMessages <- ServerMessage{Type: "rx", Data: marshalData(msg)}:
+	default:
+	}
+}
+
+func (s *Session) notifyRxText(src, text string) {
+	select {
+	case s.OutgoingMessages <- ServerMessage{Type: "text", Data: marshalData(TextMessage{Src: src, Text: text})}:
+	default:
+	}
+}
+
+func (s *Session) notifyRxData(src string, spkt *m17.StreamPacket) {
+	data := spkt.Payload[8:16]
+	if bytes.Equal(data, make([]byte, len(data))) {
+		return
+	}
+	msg := DataMessage{Src: src, Frame: spkt.FrameNum & 0x7FFF, Data: append([]byte(nil), data...)}
 	select {
-	case s.OutgoingMessages <- ServerMessage{Type: "rx", Data: marshalData(RxStatusMessage{Active: true, Src: src})}:
+	case s.OutgoingMessages <- ServerMessage{Type: "data", Data: marshalData(msg)}:
 	default:
 	}
 }
 
 func (s *Session) notifyRxInactive() {
+	msg := RxStatusMessage{Active: false}
+	if s.rxSigned {
+		msg.Signature = s.verifyRx()
+	}
+	s.rxPosition = nil
+	s.rxECD = nil
+	s.rxText.Reset()
+	s.rxLastText = ""
+	s.rxSigned = false
+	s.rxVerifier.Reset()
+	s.rxTracking = false
+	s.rxLastAudio = nil
+	s.rxDoubling = nil
+	s.rxChannel = nil
 	select {
-	case s.OutgoingMessages <- ServerMessage{Type: "rx", Data: marshalData(RxStatusMessage{Active: false})}:
+	case s.OutgoingMessages <- ServerMessage{Type: "rx", Data: marshalData(msg)}:
 	default:
 	}
 }
 
-func (s *Session) processPacket(pkt []byte, rxActive *bool) {
+// verifyRx checks the signature of the stream that just ended. It is
+// "unverified" when there is no public key for the sender and "invalid"
+// when the signature is missing or does not match.
+func (s *Session) verifyRx() string {
+	pub, err := s.PublicKeys.PublicKey(s.rxSource)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Warn("failed to load public key", "session", s.ID, "src", s.rxSource, "err", err)
+		}
+		return "unverified"
+	}
+	if !s.rxVerifier.Verify(pub) {
+		return "invalid"
+	}
+	return "verified"
+}
+
+// processPacket handles one incoming stream packet from the home module.
+func (s *Session) processPacket(pkt []byte, rxActive *bool) bool {
+	return s.processChannelPacket(s.home, pkt, rxActive)
+}
+
+// processChannelPacket handles one incoming stream packet received on ch.
+// Reception locks onto the first stream until its last frame or a timeout;
+// packets from other streams on the same channel meanwhile are reported as
+// doubling and dropped, and those on other channels are dropped unless the
+// priority scan policy lets ch take over. It returns whether the packet
+// belonged to the stream being received.
+func (s *Session) processChannelPacket(ch *scanChannel, pkt []byte, rxActive *bool) bool {
 	if len(pkt) < 4 || string(pkt[0:4]) != "M17 " {
-		return
+		return false
 	}
 
 	spkt, lsf, err := m17.ParseStreamPacketWithLSF(pkt)
 	if err != nil {
 		log.Warn("failed to parse incoming stream", "session", s.ID, "err", err)
-		return
+		return false
 	}
 
-	log.Debug("Incoming stream", "stream_id", spkt.StreamID, "src", lsf.Source, "dst", lsf.Destination, "session", s.ID)
+	if *rxActive && (ch != s.rxChannel || spkt.StreamID != s.rxStreamID) {
+		switch {
+		case ch == s.rxChannel:
+			s.notifyDoubling(spkt.StreamID, lsf)
+			return false
+		case s.scanPreempt.Load() && ch != nil && s.rxChannel != nil && ch.priority < s.rxChannel.priority:
+			log.Debug("Priority scan channel active", "session", s.ID, "reflector", ch.Reflector, "module", ch.Module)
+			*rxActive = false
+			s.notifyRxInactive()
+		default:
+			return false
+		}
+	}
 
+	log.Debug("Incoming stream", "stream_id", spkt.StreamID, "src", lsf.Source, "dst", lsf.Destination, "type", lsf.Type.DataType, "session", s.ID)
+
+	pos := lsfPosition(lsf)
+	ecd := lsfECD(lsf)
 	if !*rxActive {
 		*rxActive = true
-		s.notifyRxActive(lsf.Source)
+		s.rxChannel = ch
+		s.rxStreamID = spkt.StreamID
+		s.rxPosition = pos
+		s.rxECD = ecd
+		s.rxSigned = lsf.Type.Signed
+		s.rxSource = lsf.Source
+		s.notifyRxActive(lsf)
+	} else {
+		changed := false
+		if pos != nil && !pos.equal(s.rxPosition) {
+			s.rxPosition = pos
+			changed = true
+		}
+		if ecd != nil && (s.rxECD == nil || *ecd != *s.rxECD) {
+			s.rxECD = ecd
+			changed = true
+		}
+		if changed {
+			s.notifyRxActive(lsf)
+		}
+	}
+	lost, ok := s.trackFrame(spkt, lsf.Type.Signed)
+	if !ok {
+		return true
 	}
 
-	audioFrame, err := s.Stream.HandleIncomingPacket(pkt, s.UsePCM)
-	if err != nil {
+	if lsf.Type.Encryption == m17.EncryptionNone && lsf.Type.EncryptionSubtype == m17.MetaText {
+		if text, ok := s.rxText.Add(lsf.Meta); ok && text != "" && text != s.rxLastText {
+			s.rxLastText = text
+			s.notifyRxText(lsf.Source, text)
+		}
+	}
+
+	if lsf.Type.Signed {
+		s.rxVerifier.Add(spkt)
+	}
+
+	if lsf.Type.DataType == m17.DataTypeVoiceData && !(lsf.Type.Signed && m17.IsSignatureFrame(spkt.FrameNum)) {
+		dspkt := *spkt
+		if s.Stream.Decrypt(&dspkt, lsf) == nil {
+			s.notifyRxData(lsf.Source, &dspkt)
+		}
+	}
+
+	audioFrame, err := s.rxAudio(ch, pkt, spkt)
+	if err != nil && !errors.Is(err, m17.ErrNoKey) {
 		log.Warn("failed to parse incoming stream", "session", s.ID, "err", err)
-		return
+		return true
 	}
 	if len(audioFrame) != 0 {
-		select {
-		case s.OutgoingAudio <- audioFrame:
-		default:
-			log.Warn("dropping audio frame; outgoing channel full", "session", s.ID)
-			status.RecordAudioFrameDropped()
-		}
+		s.conceal(lost)
+		s.rxLastAudio = append(s.rxLastAudio[:0], audioFrame...)
+		s.sendAudio(audioFrame)
 	}
 
 	if spkt.IsLast() && *rxActive {
 		*rxActive = false
 		s.notifyRxInactive()
 	}
+	return true
+}
+
+// rxAudio decodes the audio of an incoming frame in the session's format,
+// reusing the decode of a shared link when it has one.
+func (s *Session) rxAudio(ch *scanChannel, pkt []byte, spkt *m17.StreamPacket) ([]byte, error) {
+	if ch != nil && ch.link != nil {
+		if pcm, ok := ch.link.decoded(spkt.StreamID, spkt.FrameNum); ok {
+			if s.UsePCM || pcm == nil {
+				return pcm, nil
+			}
+			samples := make([]int16, len(pcm)/2)
+			for i := range samples {
+				samples[i] = int16(binary.LittleEndian.Uint16(pcm[i*2:]))
+			}
+			return audio.MuLawEncode(nil, samples), nil
+		}
+	}
+	return s.Stream.HandleIncomingPacket(pkt, s.UsePCM)
+}
+
+func (s *Session) notifyDoubling(streamID uint16, lsf *m17.LSF) {
+	if s.rxDoubling[streamID] {
+		return
+	}
+	if s.rxDoubling == nil {
+		s.rxDoubling = make(map[uint16]bool)
+	}
+	s.rxDoubling[streamID] = true
+	status.RecordStreamContention()
+	log.Info("Incoming stream doubling", "session", s.ID, "stream_id", streamID, "src", lsf.Source, "locked_stream_id", s.rxStreamID)
+
+	select {
+	case s.OutgoingMessages <- ServerMessage{Type: "doubling", Data: marshalData(DoublingMessage{Src: lsf.Source, Dst: lsf.Destination})}:
+	default:
+	}
+}
+
+func (s *Session) sendAudio(frame []byte) {
+	select {
+	case s.OutgoingAudio <- frame:
+	default:
+		log.Warn("dropping audio frame; outgoing channel full", "session", s.ID)
+		status.RecordAudioFrameDropped()
+	}
+}
+
+// trackFrame checks the frame number of an incoming packet against the one
+// expected next in its stream. It returns how many frames were lost before
+// it, or false for a repeat of the previous frame or a frame arriving after
+// a later one, which have already been played or concealed.
+func (s *Session) trackFrame(spkt *m17.StreamPacket, signed bool) (int, bool) {
+	fn := spkt.FrameNum & 0x7FFF
+	if signed && m17.IsSignatureFrame(fn) {
+		return 0, true
+	}
+	if !s.rxTracking || spkt.StreamID != s.rxStreamID {
+		s.rxTracking = true
+		s.rxStreamID = spkt.StreamID
+		s.rxNextFN = (fn + 1) & 0x7FFF
+		s.rxLastAudio = nil
+		return 0, true
+	}
+
+	lost := 0
+	switch diff := (fn - s.rxNextFN) & 0x7FFF; {
+	case diff == 0:
+	case diff < 0x4000:
+		lost = int(diff)
+		status.RecordFramesLost(lost)
+		log.Debug("incoming stream frames lost", "session", s.ID, "stream_id", spkt.StreamID, "lost", lost)
+	case fn == (s.rxNextFN-1)&0x7FFF:
+		status.RecordFrameDuplicate()
+		return 0, false
+	default:
+		status.RecordFrameOutOfOrder()
+		return 0, false
+	}
+	s.rxNextFN = (fn + 1) & 0x7FFF
+	return lost, true
+}
+
+// conceal keeps the browser's playback clock aligned across lost frames by
+// repeating the last frame once and filling the rest of the gap with
+// silence.
+func (s *Session) conceal(lost int) {
+	if lost == 0 || s.rxLastAudio == nil {
+		return
+	}
+	n := min(lost, maxConcealFrames)
+	for i := 0; i < n; i++ {
+		var frame []byte
+		switch {
+		case i == 0:
+			frame = append([]byte(nil), s.rxLastAudio...)
+		case s.UsePCM:
+			frame = make([]byte, len(s.rxLastAudio))
+		default:
+			frame = audio.MuLawEncode(nil, make([]int16, len(s.rxLastAudio)))
+		}
+		s.sendAudio(frame)
+	}
+	status.RecordFramesConcealed(n)
+}
+
+func lsfPosition(lsf *m17.LSF) *PositionMessage {
+	if lsf.Type.Encryption != m17.EncryptionNone || lsf.Type.EncryptionSubtype != m17.MetaGNSS {
+		return nil
+	}
+	return positionFromGNSS(m17.DecodeGNSS(lsf.Meta))
+}
+
+func lsfECD(lsf *m17.LSF) *m17.ECD {
+	if lsf.Type.Encryption != m17.EncryptionNone || lsf.Type.EncryptionSubtype != m17.MetaECD {
+		return nil
+	}
+	ecd := m17.DecodeECD(lsf.Meta)
+	if ecd.Originator == "" && ecd.Via == "" {
+		return nil
+	}
+	return &ecd
+}
+
+func (s *Session) processDataPacket(pkt []byte) {
+	p, err := m17.ParsePacket(pkt)
+	if err != nil {
+		log.Warn("failed to parse incoming packet", "session", s.ID, "err", err)
+		return
+	}
+
+	text, ok := p.SMSText()
+	if !ok {
+		log.Debug("Ignoring packet", "type", p.Type, "src", p.LSF.Source, "session", s.ID)
+		return
+	}
+	log.Debug("Incoming SMS", "src", p.LSF.Source, "dst", p.LSF.Destination, "session", s.ID)
+
+	msg := SMSMessage{Src: p.LSF.Source, Dst: p.LSF.Destination, Text: text}
+	select {
+	case s.OutgoingMessages <- ServerMessage{Type: "sms", Data: marshalData(msg)}:
+	default:
+	}
+}
+
+func (s *Session) SendSMS(dst, text string) error {
+	if s.Reflector == nil {
+		return fmt.Errorf("no reflector connected")
+	}
+	pkt, err := m17.BuildSMS(dst, s.Callsign, s.CAN, text)
+	if err != nil {
+		return err
+	}
+	_, err = s.Reflector.Conn().WriteToUDP(pkt, s.Reflector.Addr())
+	return err
 }
@@ -1,16 +1,27 @@
 package transport
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/kc1awv/m17-webclient/internal/m17"
+	"github.com/kc1awv/m17-webclient/internal/m17/rf"
 	"github.com/kc1awv/m17-webclient/internal/reflector"
 )
 
+var voiceStream = m17.LSFType{Stream: true, DataType: m17.DataTypeVoice}
+
 func TestRemoveSessionReleasesGoroutines(t *testing.T) {
 	manager := NewSessionManager()
 	session, err := manager.AddSession()
@@ -66,7 +77,7 @@ func TestHandleReflectorPacketsDoneWithoutLeak(t *testing.T) {
 	}
 	defer conn.Close()
 
-	sh, err := m17.NewStreamHandler(conn, server.LocalAddr().(*net.UDPAddr), "SRC", "DST")
+	sh, err := m17.NewStreamHandler(conn, server.LocalAddr().(*net.UDPAddr), "SRC", "DST", 0, m17.StreamModeVoice)
 	if err != nil {
 		t.Fatalf("NewStreamHandler: %v", err)
 	}
@@ -88,7 +99,7 @@ func TestHandleReflectorPacketsDoneWithoutLeak(t *testing.T) {
 	}()
 
 	var meta [14]byte
-	lsf, _ := m17.BuildLSF("DST", "SRC", meta)
+	lsf, _ := m17.BuildLSF("DST", "SRC", voiceStream, meta)
 	lsd := m17.LSFToLSD(lsf)
 	var payload [16]byte
 	pkt, _ := m17.BuildStreamPacket(0x1234, lsd, 0, false, payload)
@@ -122,7 +133,7 @@ func TestStopStreamHandlerStopsPacketProcessing(t *testing.T) {
 	client := reflector.NewTestClient(context.Background(), conn, server.LocalAddr().(*net.UDPAddr), "TEST", 'A', "TEST", packets, nil)
 	defer client.Close()
 
-	sh, err := m17.NewStreamHandler(conn, server.LocalAddr().(*net.UDPAddr), "SRC", "DST")
+	sh, err := m17.NewStreamHandler(conn, server.LocalAddr().(*net.UDPAddr), "SRC", "DST", 0, m17.StreamModeVoice)
 	if err != nil {
 		t.Fatalf("NewStreamHandler: %v", err)
 	}
@@ -152,7 +163,7 @@ func TestStopStreamHandlerStopsPacketProcessing(t *testing.T) {
 	}
 
 	var meta [14]byte
-	lsf, _ := m17.BuildLSF("DST", "SRC", meta)
+	lsf, _ := m17.BuildLSF("DST", "SRC", voiceStream, meta)
 	lsd := m17.LSFToLSD(lsf)
 	var payload [16]byte
 	pkt, _ := m17.BuildStreamPacket(0x1234, lsd, 0, false, payload)
@@ -180,7 +191,7 @@ func TestProcessPacket(t *testing.T) {
 	}
 	defer conn.Close()
 
-	sh, err := m17.NewStreamHandler(conn, server.LocalAddr().(*net.UDPAddr), "SRC", "DST")
+	sh, err := m17.NewStreamHandler(conn, server.LocalAddr().(*net.UDPAddr), "SRC", "DST", 0, m17.StreamModeVoice)
 	if err != nil {
 		t.Fatalf("NewStreamHandler: %v", err)
 	}
@@ -195,7 +206,7 @@ func TestProcessPacket(t *testing.T) {
 	var rxActive bool
 
 	var meta [14]byte
-	lsf, _ := m17.BuildLSF("DST", "SRC", meta)
+	lsf, _ := m17.BuildLSF("DST", "SRC", voiceStream, meta)
 	lsd := m17.LSFToLSD(lsf)
 	var payload [16]byte
 
@@ -216,6 +227,12 @@ func TestProcessPacket(t *testing.T) {
 		if !data.Active {
 			t.Fatalf("expected active true, got %#v", data)
 		}
+		if data.Src != "SRC" || data.DataType != "voice" || data.Encryption != "none" {
+			t.Fatalf("unexpected stream info: %#v", data)
+		}
+		if data.CAN == nil || *data.CAN != 0 {
+			t.Fatalf("expected CAN 0, got %v", data.CAN)
+		}
 	default:
 		t.Fatalf("expected rx active message")
 	}
@@ -248,6 +265,275 @@ func TestProcessPacket(t *testing.T) {
 	}
 }
 
+func TestProcessPacketPosition(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer server.Close()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatalf("client listen: %v", err)
+	}
+	defer conn.Close()
+
+	sh, err := m17.NewStreamHandler(conn, server.LocalAddr().(*net.UDPAddr), "SRC", "DST", 0, m17.StreamModeVoice)
+	if err != nil {
+		t.Fatalf("NewStreamHandler: %v", err)
+	}
+	defer sh.Close()
+
+	s := &Session{
+		Stream:           sh,
+		OutgoingAudio:    make(chan []byte, 4),
+		OutgoingMessages: make(chan ServerMessage, 4),
+	}
+
+	var rxActive bool
+	var payload [16]byte
+
+	lsf, _ := m17.BuildLSF("DST", "SRC", voiceStream, [14]byte{})
+	pkt, _ := m17.BuildStreamPacket(0x1234, m17.LSFToLSD(lsf), 0, false, payload)
+	s.processPacket(pkt, &rxActive)
+	<-s.OutgoingMessages
+
+	meta, err := m17.EncodeGNSS(m17.GNSS{StationType: m17.StationHandheld, Latitude: 41.5, Longitude: -72.5, HasPosition: true})
+	if err != nil {
+		t.Fatalf("EncodeGNSS: %v", err)
+	}
+	typ := voiceStream
+	typ.EncryptionSubtype = m17.MetaGNSS
+	lsf, _ = m17.BuildLSF("DST", "SRC", typ, meta)
+	pkt, _ = m17.BuildStreamPacket(0x1234, m17.LSFToLSD(lsf), 1, false, payload)
+	s.processPacket(pkt, &rxActive)
+
+	select {
+	case msg := <-s.OutgoingMessages:
+		var data RxStatusMessage
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if !data.Active || data.Position == nil {
+			t.Fatalf("expected active rx with position, got %#v", data)
+		}
+		if data.Position.Station != "handheld" {
+			t.Fatalf("unexpected station type: %s", data.Position.Station)
+		}
+	default:
+		t.Fatalf("expected rx update with position")
+	}
+
+	pkt, _ = m17.BuildStreamPacket(0x1234, m17.LSFToLSD(lsf), 2, false, payload)
+	s.processPacket(pkt, &rxActive)
+	select {
+	case msg := <-s.OutgoingMessages:
+		t.Fatalf("unexpected message for unchanged position: %#v", msg)
+	default:
+	}
+}
+
+func TestProcessPacketECD(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer server.Close()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatalf("client listen: %v", err)
+	}
+	defer conn.Close()
+
+	sh, err := m17.NewStreamHandler(conn, server.LocalAddr().(*net.UDPAddr), "SRC", "DST", 0, m17.StreamModeVoice)
+	if err != nil {
+		t.Fatalf("NewStreamHandler: %v", err)
+	}
+	defer sh.Close()
+
+	s := &Session{
+		Stream:           sh,
+		OutgoingAudio:    make(chan []byte, 1),
+		OutgoingMessages: make(chan ServerMessage, 2),
+	}
+
+	meta, err := m17.EncodeECD(m17.ECD{Originator: "KC1AWV", Via: "M17-AWV A"})
+	if err != nil {
+		t.Fatalf("EncodeECD: %v", err)
+	}
+	typ := voiceStream
+	typ.EncryptionSubtype = m17.MetaECD
+	lsf, _ := m17.BuildLSF("DST", "GATEWAY", typ, meta)
+	var payload [16]byte
+	pkt, _ := m17.BuildStreamPacket(0x1234, m17.LSFToLSD(lsf), 0, false, payload)
+
+	var rxActive bool
+	s.processPacket(pkt, &rxActive)
+
+	select {
+	case msg := <-s.OutgoingMessages:
+		var data RxStatusMessage
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if data.Src != "GATEWAY" || data.Originator != "KC1AWV" || data.Via != "M17-AWV A" {
+			t.Fatalf("unexpected rx message %#v", data)
+		}
+	default:
+		t.Fatalf("expected rx active message")
+	}
+}
+
+func TestProcessPacketVoiceData(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer server.Close()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatalf("client listen: %v", err)
+	}
+	defer conn.Close()
+
+	sh, err := m17.NewStreamHandler(conn, server.LocalAddr().(*net.UDPAddr), "SRC", "DST", 0, m17.StreamModeVoice)
+	if err != nil {
+		t.Fatalf("NewStreamHandler: %v", err)
+	}
+	defer sh.Close()
+
+	s := &Session{
+		Stream:           sh,
+		UsePCM:           true,
+		OutgoingAudio:    make(chan []byte, 1),
+		OutgoingMessages: make(chan ServerMessage, 2),
+	}
+
+	typ := m17.LSFType{Stream: true, DataType: m17.DataTypeVoiceData}
+	lsf, _ := m17.BuildLSF("DST", "SRC", typ, [14]byte{})
+	var payload [16]byte
+	copy(payload[8:], "APRSDATA")
+	pkt, _ := m17.BuildStreamPacket(0x1234, m17.LSFToLSD(lsf), 3, false, payload)
+
+	var rxActive bool
+	s.processPacket(pkt, &rxActive)
+
+	<-s.OutgoingMessages
+	select {
+	case msg := <-s.OutgoingMessages:
+		if msg.Type != "data" {
+			t.Fatalf("unexpected message type: %s", msg.Type)
+		}
+		var data DataMessage
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if data.Src != "SRC" || data.Frame != 3 || string(data.Data) != "APRSDATA" {
+			t.Fatalf("unexpected data message %#v", data)
+		}
+	default:
+		t.Fatalf("expected data message")
+	}
+
+	select {
+	case frame := <-s.OutgoingAudio:
+		if len(frame) != 640 {
+			t.Fatalf("expected 40 ms of PCM, got %d bytes", len(frame))
+		}
+	default:
+		t.Fatalf("expected audio frame")
+	}
+}
+
+func TestProcessPacketText(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer server.Close()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatalf("client listen: %v", err)
+	}
+	defer conn.Close()
+
+	sh, err := m17.NewStreamHandler(conn, server.LocalAddr().(*net.UDPAddr), "SRC", "DST", 0, m17.StreamModeVoice)
+	if err != nil {
+		t.Fatalf("NewStreamHandler: %v", err)
+	}
+	defer sh.Close()
+
+	s := &Session{
+		Stream:           sh,
+		OutgoingAudio:    make(chan []byte, 8),
+		OutgoingMessages: make(chan ServerMessage, 8),
+	}
+
+	blocks, err := m17.EncodeTextBlocks("QTH FN31 / handheld")
+	if err != nil {
+		t.Fatalf("EncodeTextBlocks: %v", err)
+	}
+
+	var rxActive bool
+	var payload [16]byte
+	for i, meta := range append(blocks, blocks...) {
+		lsf, _ := m17.BuildLSF("DST", "SRC", voiceStream, meta)
+		pkt, _ := m17.BuildStreamPacket(0x1234, m17.LSFToLSD(lsf), uint16(i), false, payload)
+		s.processPacket(pkt, &rxActive)
+	}
+
+	var texts []TextMessage
+	for len(s.OutgoingMessages) > 0 {
+		msg := <-s.OutgoingMessages
+		if msg.Type != "text" {
+			continue
+		}
+		var data TextMessage
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		texts = append(texts, data)
+	}
+	if len(texts) != 1 {
+		t.Fatalf("expected one text message, got %v", texts)
+	}
+	if texts[0].Src != "SRC" || texts[0].Text != "QTH FN31 / handheld" {
+		t.Fatalf("unexpected text message %#v", texts[0])
+	}
+}
+
+func TestProcessDataPacketSMS(t *testing.T) {
+	s := &Session{
+		OutgoingAudio:    make(chan []byte, 1),
+		OutgoingMessages: make(chan ServerMessage, 1),
+	}
+
+	pkt, err := m17.BuildSMS("@ALL", "N0CALL", 0, "CQ CQ")
+	if err != nil {
+		t.Fatalf("BuildSMS: %v", err)
+	}
+	s.processDataPacket(pkt)
+
+	select {
+	case msg := <-s.OutgoingMessages:
+		if msg.Type != "sms" {
+			t.Fatalf("unexpected message type: %s", msg.Type)
+		}
+		var data SMSMessage
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if data.Src != "N0CALL" || data.Dst != "@ALL" || data.Text != "CQ CQ" {
+			t.Fatalf("unexpected sms message %#v", data)
+		}
+	default:
+		t.Fatalf("expected sms message")
+	}
+}
+
 func TestHandleReflectorPacketsTimeoutExpiration(t *testing.T) {
 	old := reflectorTimeout
 	reflectorTimeout = 100 * time.Millisecond
@@ -272,7 +558,7 @@ func TestHandleReflectorPacketsTimeoutExpiration(t *testing.T) {
 	}
 	defer conn.Close()
 
-	sh, err := m17.NewStreamHandler(conn, server.LocalAddr().(*net.UDPAddr), "SRC", "DST")
+	sh, err := m17.NewStreamHandler(conn, server.LocalAddr().(*net.UDPAddr), "SRC", "DST", 0, m17.StreamModeVoice)
 	if err != nil {
 		t.Fatalf("NewStreamHandler: %v", err)
 	}
@@ -294,7 +580,7 @@ func TestHandleReflectorPacketsTimeoutExpiration(t *testing.T) {
 	}()
 
 	var meta [14]byte
-	lsf, _ := m17.BuildLSF("DST", "SRC", meta)
+	lsf, _ := m17.BuildLSF("DST", "SRC", voiceStream, meta)
 	lsd := m17.LSFToLSD(lsf)
 	var payload [16]byte
 	pkt, _ := m17.BuildStreamPacket(0x1234, lsd, 0, false, payload)
@@ -361,7 +647,7 @@ func TestHandleReflectorPacketsNormalFlow(t *testing.T) {
 	}
 	defer conn.Close()
 
-	sh, err := m17.NewStreamHandler(conn, server.LocalAddr().(*net.UDPAddr), "SRC", "DST")
+	sh, err := m17.NewStreamHandler(conn, server.LocalAddr().(*net.UDPAddr), "SRC", "DST", 0, m17.StreamModeVoice)
 	if err != nil {
 		t.Fatalf("NewStreamHandler: %v", err)
 	}
@@ -383,7 +669,7 @@ func TestHandleReflectorPacketsNormalFlow(t *testing.T) {
 	}()
 
 	var meta [14]byte
-	lsf, _ := m17.BuildLSF("DST", "SRC", meta)
+	lsf, _ := m17.BuildLSF("DST", "SRC", voiceStream, meta)
 	lsd := m17.LSFToLSD(lsf)
 	var payload [16]byte
 	pkt, _ := m17.BuildStreamPacket(0x1234, lsd, 0, false, payload)
@@ -445,7 +731,7 @@ func TestStartStopStreamHandlerNoPanic(t *testing.T) {
 	}
 
 	var meta [14]byte
-	lsf, _ := m17.BuildLSF("DST", "SRC", meta)
+	lsf, _ := m17.BuildLSF("DST", "SRC", voiceStream, meta)
 	lsd := m17.LSFToLSD(lsf)
 	var payload [16]byte
 	pkt, _ := m17.BuildStreamPacket(0x1234, lsd, 0, false, payload)
@@ -476,3 +762,446 @@ func TestStartStopStreamHandlerNoPanic(t *testing.T) {
 
 	close(stopPackets)
 }
+
+func TestReattachReflectorDuringRestart(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatalf("client listen: %v", err)
+	}
+	defer conn.Close()
+
+	client := reflector.NewTestClient(context.Background(), conn, conn.LocalAddr().(*net.UDPAddr), "TEST", 'A', "TEST", nil, nil)
+	defer client.Close()
+
+	s := &Session{
+		Reflector:        client,
+		Callsign:         "SRC",
+		OutgoingAudio:    make(chan []byte, 1),
+		OutgoingMessages: make(chan ServerMessage, 1),
+	}
+
+	// Reconnect events arrive on the reflector's goroutine while the
+	// session restarts its stream handler, e.g. on a mode change.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			s.reattachReflector(client)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if err := s.StartStreamHandler(); err != nil {
+			t.Fatalf("StartStreamHandler: %v", err)
+		}
+	}
+	<-done
+	s.StopStreamHandler()
+}
+
+func TestTransmitRecordedAsBaseband(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer server.Close()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatalf("client listen: %v", err)
+	}
+	defer conn.Close()
+	client := reflector.NewTestClient(context.Background(), conn, server.LocalAddr().(*net.UDPAddr), "TEST", 'A', "TEST", nil, nil)
+	defer client.Close()
+
+	dir := t.TempDir()
+	s := &Session{
+		ID:               "rf",
+		Reflector:        client,
+		Callsign:         "N0CALL",
+		BasebandDir:      dir,
+		OutgoingAudio:    make(chan []byte, 1),
+		OutgoingMessages: make(chan ServerMessage, 1),
+	}
+	if err := s.StartStreamHandler(); err != nil {
+		t.Fatalf("StartStreamHandler: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		if err := s.HandlePCMFrame(make([]int16, 320), i == 3); err != nil {
+			t.Fatalf("HandlePCMFrame: %v", err)
+		}
+	}
+	s.StopStreamHandler()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*-rf.wav"))
+	if len(files) != 1 {
+		t.Fatalf("got recordings %v, want one", files)
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+
+	packets := make(chan []byte, 10)
+	if err := rf.NewReceiver(packets).Run(f); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	close(packets)
+	var got []*m17.StreamPacket
+	for pkt := range packets {
+		sp, lsf, err := m17.ParseStreamPacketWithLSF(pkt)
+		if err != nil {
+			t.Fatalf("ParseStreamPacketWithLSF: %v", err)
+		}
+		if lsf.Source != "N0CALL" {
+			t.Errorf("source %q, want N0CALL", lsf.Source)
+		}
+		got = append(got, sp)
+	}
+	if len(got) != 4 || !got[3].IsLast() {
+		t.Fatalf("decoded %d frames from the recording, want 4 ending with the last", len(got))
+	}
+}
+
+func TestReceiveRF(t *testing.T) {
+	lsf, _ := m17.BuildLSF("DST", "SRC", voiceStream, [14]byte{})
+	lsd := m17.LSFToLSD(lsf)
+
+	var wav bytes.Buffer
+	bw, err := rf.NewBasebandWriter(&wav)
+	if err != nil {
+		t.Fatalf("NewBasebandWriter: %v", err)
+	}
+	mod := rf.NewModulator(bw)
+	for i := 0; i < 3; i++ {
+		pkt, _ := m17.BuildStreamPacket(0x1234, lsd, uint16(i), i == 2, [16]byte{})
+		if err := mod.WritePacket(pkt); err != nil {
+			t.Fatalf("WritePacket: %v", err)
+		}
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	s := &Session{
+		Callsign:         "N0CALL",
+		OutgoingAudio:    make(chan []byte, 10),
+		OutgoingMessages: make(chan ServerMessage, 10),
+	}
+	if err := s.ReceiveRF(&wav); err != nil {
+		t.Fatalf("ReceiveRF: %v", err)
+	}
+	if s.Stream != nil {
+		t.Fatal("temporary stream handler not released")
+	}
+
+	var active []bool
+	for len(s.OutgoingMessages) > 0 {
+		msg := <-s.OutgoingMessages
+		var data RxStatusMessage
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if data.Active && data.Src != "SRC" {
+			t.Errorf("unexpected src %q", data.Src)
+		}
+		active = append(active, data.Active)
+	}
+	if len(active) != 2 || !active[0] || active[1] {
+		t.Fatalf("expected rx active then inactive, got %v", active)
+	}
+	if n := len(s.OutgoingAudio); n != 3 {
+		t.Fatalf("got %d audio frames, want 3", n)
+	}
+}
+
+func TestProcessPacketEncryptedNoKey(t *testing.T) {
+	sh, err := m17.NewStreamHandler(nil, nil, "SRC", "DST", 0, m17.StreamModeVoice)
+	if err != nil {
+		t.Fatalf("NewStreamHandler: %v", err)
+	}
+	defer sh.Close()
+
+	s := &Session{
+		Stream:           sh,
+		OutgoingAudio:    make(chan []byte, 1),
+		OutgoingMessages: make(chan ServerMessage, 2),
+	}
+
+	typ := m17.LSFType{Stream: true, DataType: m17.DataTypeVoice, Encryption: m17.EncryptionAES, EncryptionSubtype: m17.AES128}
+	lsf, _ := m17.BuildLSF("DST", "SRC", typ, [14]byte{1, 2, 3})
+	pkt, _ := m17.BuildStreamPacket(0x1234, m17.LSFToLSD(lsf), 0, false, [16]byte{})
+
+	var rxActive bool
+	s.processPacket(pkt, &rxActive)
+
+	msg := <-s.OutgoingMessages
+	var data RxStatusMessage
+	if err := json.Unmarshal(msg.Data, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.Encryption != "aes" || !data.NoKey {
+		t.Fatalf("expected encrypted stream without key, got %#v", data)
+	}
+	if len(s.OutgoingAudio) != 0 {
+		t.Fatal("expected no audio for encrypted stream without key")
+	}
+
+	key, _ := m17.NewKey(m17.EncryptionAES, make([]byte, 16))
+	if err := sh.SetKey(key); err != nil {
+		t.Fatalf("SetKey: %v", err)
+	}
+	pkt, _ = m17.BuildStreamPacket(0x1234, m17.LSFToLSD(lsf), 1, false, [16]byte{})
+	s.processPacket(pkt, &rxActive)
+	if len(s.OutgoingAudio) != 1 {
+		t.Fatal("expected audio once the key is loaded")
+	}
+}
+
+func TestProcessPacketSignedStream(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	dir := t.TempDir()
+	der, _ := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err := os.WriteFile(filepath.Join(dir, "SRC.pem"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+
+	typ := m17.LSFType{Stream: true, DataType: m17.DataTypeVoice, Signed: true}
+	lsf, _ := m17.BuildLSF("DST", "SRC", typ, [14]byte{})
+	lsd := m17.LSFToLSD(lsf)
+
+	buildStream := func(tamper bool) [][]byte {
+		var digest m17.StreamDigest
+		var pkts [][]byte
+		for fn := uint16(0); fn < 3; fn++ {
+			payload := [16]byte{byte(fn), 0xAA}
+			digest.Add(payload)
+			pkt, _ := m17.BuildStreamPacket(0x1234, lsd, fn, false, payload)
+			pkts = append(pkts, pkt)
+		}
+		sig, err := m17.SignDigest(priv, digest)
+		if err != nil {
+			t.Fatalf("SignDigest: %v", err)
+		}
+		if tamper {
+			sig[0] ^= 0xFF
+		}
+		for i := 0; i < m17.SignatureFrames; i++ {
+			var payload [16]byte
+			copy(payload[:], sig[i*16:])
+			pkt, _ := m17.BuildStreamPacket(0x1234, lsd, uint16(0x7FFC+i), i == m17.SignatureFrames-1, payload)
+			pkts = append(pkts, pkt)
+		}
+		return pkts
+	}
+
+	tests := []struct {
+		name   string
+		keys   m17.KeyDir
+		tamper bool
+		want   string
+	}{
+		{"verified", m17.KeyDir(dir), false, "verified"},
+		{"invalid", m17.KeyDir(dir), true, "invalid"},
+		{"unverified", m17.KeyDir(t.TempDir()), false, "unverified"},
+	}
+	for _, tt := range tests {
+		sh, err := m17.NewStreamHandler(nil, nil, "N0CALL", "", 0, m17.StreamModeVoice)
+		if err != nil {
+			t.Fatalf("NewStreamHandler: %v", err)
+		}
+		s := &Session{
+			Stream:           sh,
+			PublicKeys:       tt.keys,
+			OutgoingAudio:    make(chan []byte, 10),
+			OutgoingMessages: make(chan ServerMessage, 10),
+		}
+		var rxActive bool
+		for _, pkt := range buildStream(tt.tamper) {
+			s.processPacket(pkt, &rxActive)
+		}
+		sh.Close()
+
+		if n := len(s.OutgoingAudio); n != 3 {
+			t.Errorf("%s: got %d audio frames, want 3", tt.name, n)
+		}
+		var last RxStatusMessage
+		for len(s.OutgoingMessages) > 0 {
+			msg := <-s.OutgoingMessages
+			if err := json.Unmarshal(msg.Data, &last); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+		}
+		if last.Active || last.Signature != tt.want {
+			t.Errorf("%s: got %#v, want signature %q", tt.name, last, tt.want)
+		}
+	}
+}
+
+func TestProcessPacketConcealsLostFrames(t *testing.T) {
+	sh, err := m17.NewStreamHandler(nil, nil, "N0CALL", "", 0, m17.StreamModeVoice)
+	if err != nil {
+		t.Fatalf("NewStreamHandler: %v", err)
+	}
+	defer sh.Close()
+
+	s := &Session{
+		Stream:           sh,
+		UsePCM:           true,
+		OutgoingAudio:    make(chan []byte, 20),
+		OutgoingMessages: make(chan ServerMessage, 10),
+	}
+
+	lsf, _ := m17.BuildLSF("DST", "SRC", voiceStream, [14]byte{})
+	lsd := m17.LSFToLSD(lsf)
+	var rxActive bool
+	for _, fn := range []uint16{0, 1, 4, 4, 3, 5} {
+		pkt, _ := m17.BuildStreamPacket(0x1234, lsd, fn, false, [16]byte{byte(fn)})
+		s.processPacket(pkt, &rxActive)
+	}
+
+	// 0, 1, two concealed for 2 and 3, 4, 5; the repeated 4 and late 3
+	// are discarded.
+	if n := len(s.OutgoingAudio); n != 6 {
+		t.Fatalf("got %d audio frames, want 6", n)
+	}
+	var frames [][]byte
+	for len(s.OutgoingAudio) > 0 {
+		frames = append(frames, <-s.OutgoingAudio)
+	}
+	if !bytes.Equal(frames[2], frames[1]) {
+		t.Error("first concealment frame does not repeat the last frame")
+	}
+	if !bytes.Equal(frames[3], make([]byte, len(frames[3]))) {
+		t.Error("second concealment frame is not silence")
+	}
+
+	// A new stream starts its own sequence once the first has timed out.
+	rxActive = false
+	s.notifyRxInactive()
+	pkt, _ := m17.BuildStreamPacket(0x5678, lsd, 100, false, [16]byte{})
+	s.processPacket(pkt, &rxActive)
+	if n := len(s.OutgoingAudio); n != 1 {
+		t.Fatalf("got %d audio frames for new stream, want 1", n)
+	}
+}
+
+func TestProcessPacketLocksFirstStream(t *testing.T) {
+	sh, err := m17.NewStreamHandler(nil, nil, "N0CALL", "", 0, m17.StreamModeVoice)
+	if err != nil {
+		t.Fatalf("NewStreamHandler: %v", err)
+	}
+	defer sh.Close()
+
+	s := &Session{
+		Stream:           sh,
+		UsePCM:           true,
+		OutgoingAudio:    make(chan []byte, 20),
+		OutgoingMessages: make(chan ServerMessage, 10),
+	}
+
+	first, _ := m17.BuildLSF("DST", "FIRST", voiceStream, [14]byte{})
+	second, _ := m17.BuildLSF("DST", "SECOND", voiceStream, [14]byte{})
+	var rxActive bool
+	for fn := uint16(0); fn < 3; fn++ {
+		pkt, _ := m17.BuildStreamPacket(0x1111, m17.LSFToLSD(first), fn, false, [16]byte{})
+		if !s.processPacket(pkt, &rxActive) {
+			t.Fatalf("frame %d of locked stream not accepted", fn)
+		}
+		pkt, _ = m17.BuildStreamPacket(0x2222, m17.LSFToLSD(second), fn, false, [16]byte{})
+		if s.processPacket(pkt, &rxActive) {
+			t.Fatalf("frame %d of competing stream accepted", fn)
+		}
+	}
+
+	if n := len(s.OutgoingAudio); n != 3 {
+		t.Fatalf("got %d audio frames, want 3", n)
+	}
+	var doubling []DoublingMessage
+	for len(s.OutgoingMessages) > 0 {
+		msg := <-s.OutgoingMessages
+		if msg.Type != "doubling" {
+			continue
+		}
+		var d DoublingMessage
+		if err := json.Unmarshal(msg.Data, &d); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		doubling = append(doubling, d)
+	}
+	if len(doubling) != 1 || doubling[0].Src != "SECOND" {
+		t.Fatalf("got doubling messages %#v, want one from SECOND", doubling)
+	}
+
+	// After the locked stream ends the other stream is received.
+	pkt, _ := m17.BuildStreamPacket(0x1111, m17.LSFToLSD(first), 3|0x8000, false, [16]byte{})
+	s.processPacket(pkt, &rxActive)
+	pkt, _ = m17.BuildStreamPacket(0x2222, m17.LSFToLSD(second), 3, false, [16]byte{})
+	if !s.processPacket(pkt, &rxActive) {
+		t.Fatal("competing stream not accepted after locked stream ended")
+	}
+}
+
+func TestProcessChannelPacketScanPolicy(t *testing.T) {
+	for _, preempt := range []bool{true, false} {
+		sh, err := m17.NewStreamHandler(nil, nil, "N0CALL", "", 0, m17.StreamModeVoice)
+		if err != nil {
+			t.Fatalf("NewStreamHandler: %v", err)
+		}
+		defer sh.Close()
+
+		home := &scanChannel{Reflector: "M17-AAA", Module: "A"}
+		other := &scanChannel{Reflector: "M17-BBB", Module: "C", priority: 1}
+		s := &Session{
+			Stream:           sh,
+			UsePCM:           true,
+			home:             home,
+			OutgoingAudio:    make(chan []byte, 20),
+			OutgoingMessages: make(chan ServerMessage, 10),
+		}
+		s.scanPreempt.Store(preempt)
+
+		lsf, _ := m17.BuildLSF("DST", "SRC", voiceStream, [14]byte{})
+		lsd := m17.LSFToLSD(lsf)
+		var rxActive bool
+		pkt, _ := m17.BuildStreamPacket(0x1111, lsd, 0, false, [16]byte{})
+		if !s.processChannelPacket(other, pkt, &rxActive) {
+			t.Fatal("scanned stream not accepted")
+		}
+		pkt, _ = m17.BuildStreamPacket(0x2222, lsd, 0, false, [16]byte{})
+		if got := s.processPacket(pkt, &rxActive); got != preempt {
+			t.Fatalf("preempt %v: home stream accepted = %v", preempt, got)
+		}
+
+		var rx []RxStatusMessage
+		for len(s.OutgoingMessages) > 0 {
+			msg := <-s.OutgoingMessages
+			if msg.Type == "doubling" {
+				t.Fatalf("preempt %v: stream on another channel reported as doubling", preempt)
+			}
+			var m RxStatusMessage
+			if err := json.Unmarshal(msg.Data, &m); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			rx = append(rx, m)
+		}
+		if rx[0].Reflector != "M17-BBB" || rx[0].Module != "C" {
+			t.Fatalf("first rx not tagged with scanned channel: %+v", rx[0])
+		}
+		if !preempt {
+			if len(rx) != 1 {
+				t.Fatalf("got %d rx messages, want 1", len(rx))
+			}
+			continue
+		}
+		if len(rx) != 3 || rx[1].Active || !rx[2].Active || rx[2].Module != "A" {
+			t.Fatalf("unexpected rx messages %+v", rx)
+		}
+		pkt, _ = m17.BuildStreamPacket(0x1111, lsd, 1, false, [16]byte{})
+		if s.processChannelPacket(other, pkt, &rxActive) {
+			t.Fatal("lower priority channel accepted while home is active")
+		}
+	}
+}
@@ -3,19 +3,31 @@ package transport
 import (
 	"context"
 	"encoding/json"
+	"strings"
 	"sync"
 	"time"
 
 	log "github.com/kc1awv/m17-webclient/internal/logger"
+	"github.com/kc1awv/m17-webclient/internal/m17"
 	"github.com/kc1awv/m17-webclient/internal/reflector"
 )
 
 type WebSocketConfig struct {
 	OriginValidator    func(string) bool
 	NewReflectorClient func(ctx context.Context, addr, callsign string, module byte) (*reflector.ReflectorClient, error)
-	PingInterval       time.Duration
-	PongWait           time.Duration
-	ServerName         string
+	// Links, when set, shares one reflector connection per module among
+	// sessions instead of connecting each session on its own.
+	Links *LinkManager
+	// NewListenClient connects listen-only sessions.
+	NewListenClient func(ctx context.Context, addr, callsign string, module byte) (*reflector.ReflectorClient, error)
+	PingInterval    time.Duration
+	PongWait        time.Duration
+	ServerName      string
+	SigningKeyDir   string
+	PublicKeyDir    string
+	// BasebandDir, when set, is where each session's transmissions are
+	// recorded as 48 kHz M17 baseband WAV files.
+	BasebandDir string
 }
 
 func (c *WebSocketConfig) applyDefaults() {
@@ -25,6 +37,9 @@ func (c *WebSocketConfig) applyDefaults() {
 	if c.NewReflectorClient == nil {
 		c.NewReflectorClient = reflector.NewReflectorClient
 	}
+	if c.NewListenClient == nil {
+		c.NewListenClient = reflector.NewListenClient
+	}
 	if c.PingInterval <= 0 {
 		c.PingInterval = defaultPingInterval
 	}
@@ -49,9 +64,14 @@ type WelcomeMessage struct {
 }
 
 type JoinedMessage struct {
-	Reflector string `json:"reflector"`
-	Module    string `json:"module"`
-	Callsign  string `json:"callsign"`
+	Reflector   string `json:"reflector"`
+	Module      string `json:"module"`
+	Callsign    string `json:"callsign"`
+	CAN         uint8  `json:"can"`
+	Mode        string `json:"mode"`
+	Destination string `json:"destination,omitempty"`
+	Signed      bool   `json:"signed,omitempty"`
+	ListenOnly  bool   `json:"listen_only,omitempty"`
 }
 
 type PTTMessage struct {
@@ -63,8 +83,148 @@ type FormatMessage struct {
 }
 
 type RxStatusMessage struct {
-	Active bool   `json:"active"`
-	Src    string `json:"src,omitempty"`
+	Active     bool   `json:"active"`
+	Src        string `json:"src,omitempty"`
+	Dst        string `json:"dst,omitempty"`
+	DataType   string `json:"data_type,omitempty"`
+	Encryption string `json:"encryption,omitempty"`
+	NoKey      bool   `json:"no_key,omitempty"`
+	Signed     bool   `json:"signed,omitempty"`
+	CAN        *uint8 `json:"can,omitempty"`
+	Originator string `json:"originator,omitempty"`
+	Via        string `json:"via,omitempty"`
+	Signature  string `json:"signature,omitempty"`
+	// Reflector and Module name the channel the stream is received on.
+	Reflector string `json:"reflector,omitempty"`
+	Module    string `json:"module,omitempty"`
+
+	Position *PositionMessage `json:"position,omitempty"`
+}
+
+type ScanChannelMessage struct {
+	Reflector string `json:"reflector"`
+	Module    string `json:"module"`
+}
+
+type ScanMessage struct {
+	Channels []ScanChannelMessage `json:"channels"`
+	Policy   string               `json:"policy"`
+}
+
+type DataMessage struct {
+	Src   string `json:"src"`
+	Frame uint16 `json:"frame"`
+	Data  []byte `json:"data"`
+}
+
+// DataQueuedMessage acknowledges a data message with the number of bytes
+// waiting to be sent.
+type DataQueuedMessage struct {
+	Queued int `json:"queued"`
+}
+
+type SMSMessage struct {
+	Src  string `json:"src,omitempty"`
+	Dst  string `json:"dst"`
+	Text string `json:"text"`
+}
+
+type KeyMessage struct {
+	Type string `json:"type"`
+	Bits int    `json:"bits"`
+}
+
+type DoublingMessage struct {
+	Src string `json:"src"`
+	Dst string `json:"dst,omitempty"`
+}
+
+type TextMessage struct {
+	Src  string `json:"src,omitempty"`
+	Text string `json:"text"`
+}
+
+type PositionMessage struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Altitude  *float64 `json:"altitude,omitempty"`
+	Bearing   *uint16  `json:"bearing,omitempty"`
+	Speed     *float64 `json:"speed,omitempty"`
+	Station   string   `json:"station,omitempty"`
+}
+
+func positionFromGNSS(g m17.GNSS) *PositionMessage {
+	if !g.HasPosition {
+		return nil
+	}
+	p := &PositionMessage{
+		Latitude:  g.Latitude,
+		Longitude: g.Longitude,
+		Station:   g.StationType.String(),
+	}
+	if g.HasAltitude {
+		alt := g.Altitude
+		p.Altitude = &alt
+	}
+	if g.HasVelocity {
+		bearing, speed := g.Bearing, g.Speed
+		p.Bearing = &bearing
+		p.Speed = &speed
+	}
+	return p
+}
+
+func (p *PositionMessage) equal(o *PositionMessage) bool {
+	if p == nil || o == nil {
+		return p == o
+	}
+	return p.Latitude == o.Latitude &&
+		p.Longitude == o.Longitude &&
+		p.Station == o.Station &&
+		equalPtr(p.Altitude, o.Altitude) &&
+		equalPtr(p.Bearing, o.Bearing) &&
+		equalPtr(p.Speed, o.Speed)
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func (p PositionMessage) toGNSS() (m17.GNSS, error) {
+	g := m17.GNSS{
+		Source:      m17.GNSSSourceM17Client,
+		StationType: m17.StationFixed,
+		Latitude:    p.Latitude,
+		Longitude:   p.Longitude,
+		HasPosition: true,
+	}
+	if p.Station != "" {
+		st, err := m17.ParseStationType(strings.ToLower(p.Station))
+		if err != nil {
+			return g, err
+		}
+		g.StationType = st
+	}
+	if p.Altitude != nil {
+		g.Altitude = *p.Altitude
+		g.HasAltitude = true
+	}
+	if p.Bearing != nil || p.Speed != nil {
+		if p.Bearing != nil {
+			g.Bearing = *p.Bearing
+		}
+		if p.Speed != nil {
+			g.Speed = *p.Speed
+		}
+		g.HasVelocity = true
+	}
+	if _, err := m17.EncodeGNSS(g); err != nil {
+		return g, err
+	}
+	return g, nil
 }
 
 type ErrorMessage struct {
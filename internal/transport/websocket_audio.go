@@ -10,6 +10,15 @@ import (
 )
 
 func (s *Session) handleAudio(conn *websocket.Conn, mu *sync.Mutex, msg []byte) {
+	if s.ListenOnly {
+		log.Warn("Received audio on listen-only session", "session", s.ID)
+		sendError(conn, mu, errListenOnly)
+		return
+	}
+	if s.link != nil && !s.link.link.transmitting(s) {
+		log.Debug("Dropping audio without PTT on shared link", "session", s.ID)
+		return
+	}
 	if s.Stream != nil {
 		if s.UsePCM {
 			s.handlePCM(conn, mu, msg)
@@ -10,6 +10,7 @@ import (
 
 	"github.com/gorilla/websocket"
 	log "github.com/kc1awv/m17-webclient/internal/logger"
+	"github.com/kc1awv/m17-webclient/internal/m17"
 	"github.com/kc1awv/m17-webclient/internal/status"
 )
 
@@ -60,6 +61,9 @@ func HandleWebSocket(manager *SessionManager, cfg WebSocketConfig, w http.Respon
 		sendError(conn, &writeMu, err.Error())
 		return
 	}
+	session.SigningKeys = m17.KeyDir(cfg.SigningKeyDir)
+	session.PublicKeys = m17.KeyDir(cfg.PublicKeyDir)
+	session.BasebandDir = cfg.BasebandDir
 	log.Info("New session connected", "session", session.ID)
 
 	go func() {
@@ -146,13 +150,27 @@ func serveClient(ctx context.Context, session *Session, conn *websocket.Conn, cf
 		case "ping":
 			session.handlePing(conn, mu)
 		case "join":
-			session.handleJoin(ctx, conn, mu, clientMsg.Data, sendDisconnected, cfg.NewReflectorClient)
+			session.handleJoin(ctx, conn, mu, clientMsg.Data, sendDisconnected, cfg)
+		case "qsy":
+			session.handleQSY(ctx, conn, mu, clientMsg.Data, sendDisconnected, cfg)
+		case "scan":
+			session.handleScan(ctx, conn, mu, clientMsg.Data, cfg.NewListenClient)
 		case "ptt":
 			session.handlePTT(conn, mu, clientMsg.Data)
 		case "disconnect":
 			session.handleDisconnect(conn, sendDisconnected)
 		case "format":
 			session.handleFormat(conn, mu, clientMsg.Data)
+		case "position":
+			session.handlePosition(conn, mu, clientMsg.Data)
+		case "text":
+			session.handleText(conn, mu, clientMsg.Data)
+		case "sms":
+			session.handleSMS(conn, mu, clientMsg.Data)
+		case "key":
+			session.handleKey(conn, mu, clientMsg.Data)
+		case "data":
+			session.handleData(conn, mu, clientMsg.Data)
 		default:
 			session.handleUnknown(conn, mu, clientMsg.Type)
 		}
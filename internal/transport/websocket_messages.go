@@ -2,7 +2,10 @@ package transport
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -14,24 +17,85 @@ import (
 	"github.com/kc1awv/m17-webclient/internal/status"
 )
 
+const (
+	errListenOnly = "Session is listen-only"
+	errLinkBusy   = "Another user is transmitting on this module"
+)
+
+// listenerCallsign names anonymous listen-only sessions to the reflector.
+func listenerCallsign(sessionID string) string {
+	id := strings.ToUpper(strings.ReplaceAll(sessionID, "-", ""))
+	if len(id) > 6 {
+		id = id[:6]
+	}
+	return "SWL" + id
+}
+
 func (s *Session) handlePing(conn *websocket.Conn, mu *sync.Mutex) {
 	if err := writeJSON(mu, conn, ServerMessage{Type: "pong"}); err != nil {
 		log.Warn("Error sending pong", "session", s.ID, "err", err)
 	}
 }
 
-func (s *Session) handleJoin(ctx context.Context, conn *websocket.Conn, mu *sync.Mutex, data json.RawMessage, sendDisconnected func(), newReflectorClient func(context.Context, string, string, byte) (*reflector.ReflectorClient, error)) {
+type joinRequest struct {
+	Callsign    string `json:"callsign"`
+	Reflector   string `json:"reflector"`
+	Module      string `json:"module"`
+	CAN         *int   `json:"can"`
+	Destination string `json:"destination"`
+	Mode        string `json:"mode"`
+	ListenOnly  bool   `json:"listen_only"`
+	// SigningToken unlocks the signing key of Callsign.
+	SigningToken string `json:"signing_token"`
+}
+
+func (s *Session) handleJoin(ctx context.Context, conn *websocket.Conn, mu *sync.Mutex, data json.RawMessage, sendDisconnected func(), cfg WebSocketConfig) {
+	var payload joinRequest
+	if err := json.Unmarshal(data, &payload); err != nil {
+		errStr := fmt.Sprintf("Invalid join payload: %v", err)
+		log.Warn("Invalid join payload", "session", s.ID, "err", err)
+		sendError(conn, mu, errStr)
+		return
+	}
+	s.join(ctx, conn, mu, payload, sendDisconnected, cfg)
+}
+
+// handleQSY moves a joined session to another module or reflector, keeping
+// the rest of its join settings.
+func (s *Session) handleQSY(ctx context.Context, conn *websocket.Conn, mu *sync.Mutex, data json.RawMessage, sendDisconnected func(), cfg WebSocketConfig) {
 	var payload struct {
-		Callsign  string `json:"callsign"`
 		Reflector string `json:"reflector"`
 		Module    string `json:"module"`
 	}
 	if err := json.Unmarshal(data, &payload); err != nil {
-		errStr := fmt.Sprintf("Invalid join payload: %v", err)
-		log.Warn("Invalid join payload", "session", s.ID, "err", err)
+		errStr := fmt.Sprintf("Invalid qsy payload: %v", err)
+		log.Warn("Invalid qsy payload", "session", s.ID, "err", err)
 		sendError(conn, mu, errStr)
 		return
 	}
+	if s.Reflector == nil || s.joinReq == nil {
+		log.Warn("QSY without a joined reflector", "session", s.ID)
+		sendError(conn, mu, "Not joined to a reflector")
+		return
+	}
+	req := *s.joinReq
+	if payload.Reflector != "" {
+		req.Reflector = payload.Reflector
+	}
+	if payload.Module != "" {
+		req.Module = payload.Module
+	}
+	s.join(ctx, conn, mu, req, sendDisconnected, cfg)
+}
+
+// join connects the session to the reflector module in req. A session that
+// is already joined is first taken off its current reflector, so a repeated
+// join acts as a QSY.
+func (s *Session) join(ctx context.Context, conn *websocket.Conn, mu *sync.Mutex, payload joinRequest, sendDisconnected func(), cfg WebSocketConfig) {
+	req := payload
+	if payload.ListenOnly && strings.TrimSpace(payload.Callsign) == "" {
+		payload.Callsign = listenerCallsign(s.ID)
+	}
 	callsign, err := m17.ValidateCallsign(payload.Callsign)
 	if err != nil {
 		errStr := fmt.Sprintf("Invalid callsign: %v", err)
@@ -39,7 +103,34 @@ func (s *Session) handleJoin(ctx context.Context, conn *websocket.Conn, mu *sync
 		sendError(conn, mu, errStr)
 		return
 	}
-	s.Callsign = callsign
+	can := uint8(0)
+	if payload.CAN != nil {
+		if *payload.CAN < 0 || *payload.CAN > m17.MaxCAN {
+			errStr := fmt.Sprintf("Invalid CAN: %d", *payload.CAN)
+			log.Warn("Invalid CAN", "session", s.ID, "can", *payload.CAN)
+			sendError(conn, mu, errStr)
+			return
+		}
+		can = uint8(*payload.CAN)
+	}
+	mode, err := m17.ParseStreamMode(payload.Mode)
+	if err != nil {
+		errStr := fmt.Sprintf("Invalid mode: %s", payload.Mode)
+		log.Warn("Invalid mode", "session", s.ID, "mode", payload.Mode)
+		sendError(conn, mu, errStr)
+		return
+	}
+	destination := ""
+	if payload.Destination != "" {
+		addr, err := m17.ParseAddress(payload.Destination)
+		if err != nil || addr == m17.AddressInvalid {
+			errStr := fmt.Sprintf("Invalid destination: %s", payload.Destination)
+			log.Warn("Invalid destination", "session", s.ID, "destination", payload.Destination, "err", err)
+			sendError(conn, mu, errStr)
+			return
+		}
+		destination = addr.String()
+	}
 	moduleByte := byte('A')
 	if len(payload.Module) > 0 {
 		moduleByte = payload.Module[0]
@@ -51,28 +142,104 @@ func (s *Session) handleJoin(ctx context.Context, conn *websocket.Conn, mu *sync
 		return
 	}
 
-	rc, err := newReflectorClient(ctx, payload.Reflector, s.Callsign, moduleByte)
-	if err != nil {
+	var signer *ecdsa.PrivateKey
+	if payload.SigningToken != "" {
+		signer, err = s.SigningKeys.SigningKey(callsign, payload.SigningToken)
+		if errors.Is(err, m17.ErrSigningToken) {
+			log.Warn("Invalid signing token", "session", s.ID, "callsign", callsign)
+			sendError(conn, mu, "Invalid signing token")
+			return
+		}
+		if err != nil {
+			log.Error("Failed to load signing key", "session", s.ID, "callsign", callsign, "err", err)
+			sendError(conn, mu, "Failed to load signing key")
+			return
+		}
+	}
+
+	qsy := s.Reflector != nil
+	if qsy {
+		log.Info("Session QSY", "session", s.ID, "reflector", payload.Reflector, "module", string(moduleByte))
+		s.leaveReflector()
+	}
+	s.Callsign = callsign
+	s.CAN = can
+	s.Destination = destination
+	s.Mode = mode
+	s.ListenOnly = payload.ListenOnly
+	s.signer = signer
+
+	connectFailed := func(err error) {
 		errStr := fmt.Sprintf("Failed to connect to reflector: %v", err)
 		log.Warn("Failed to connect to reflector", "session", s.ID, "err", err)
 		sendError(conn, mu, errStr)
-		return
+		if qsy {
+			// The old reflector is already gone.
+			sendDisconnected()
+		}
+	}
+
+	var rc *reflector.ReflectorClient
+	onEvent := func(evt reflector.Event) {
+		switch evt {
+		case reflector.EventNACK:
+			log.Warn("Session received NACK from reflector", "session", s.ID)
+			select {
+			case s.OutgoingMessages <- ServerMessage{Type: "nack"}:
+			default:
+			}
+			sendDisconnected()
+		case reflector.EventReconnecting:
+			select {
+			case s.OutgoingMessages <- ServerMessage{Type: "reconnecting"}:
+			default:
+			}
+		case reflector.EventReconnected:
+			log.Info("Session reconnected to reflector", "session", s.ID)
+			s.reattachReflector(rc)
+			select {
+			case s.OutgoingMessages <- ServerMessage{Type: "reconnected"}:
+			default:
+			}
+		}
+	}
+
+	if cfg.Links != nil {
+		sub, err := cfg.Links.Subscribe(s, payload.Reflector, moduleByte, s.ListenOnly, onEvent)
+		if err != nil {
+			connectFailed(err)
+			return
+		}
+		s.link = sub
+		rc = sub.link.client
+	} else {
+		connect := cfg.NewReflectorClient
+		if s.ListenOnly {
+			connect = cfg.NewListenClient
+		}
+		var err error
+		rc, err = connect(ctx, payload.Reflector, s.Callsign, moduleByte)
+		if err != nil {
+			connectFailed(err)
+			return
+		}
+		go func() {
+			for evt := range rc.Events {
+				onEvent(evt)
+			}
+		}()
 	}
 	s.Reflector = rc
+	s.joinReq = &req
+	left := make(chan struct{})
+	s.left = left
 	go func() {
 		<-rc.Done()
-		sendDisconnected()
-	}()
-	go func() {
-		for evt := range rc.Events {
-			if evt == reflector.EventNACK {
-				log.Warn("Session received NACK from reflector", "session", s.ID)
-				select {
-				case s.OutgoingMessages <- ServerMessage{Type: "nack"}:
-				default:
-				}
-				sendDisconnected()
-			}
+		select {
+		case <-left:
+			// Taken down by a QSY, not lost.
+		default:
+			sendDisconnected()
 		}
 	}()
 	if err := s.StartStreamHandler(); err != nil {
@@ -86,18 +253,92 @@ func (s *Session) handleJoin(ctx context.Context, conn *websocket.Conn, mu *sync
 		"reflector", payload.Reflector,
 		"module", string(moduleByte),
 		"callsign", s.Callsign,
+		"can", s.CAN,
+		"mode", s.Mode,
+		"listen_only", s.ListenOnly,
 	)
-	status.RecordSessionStarted()
+	if !qsy {
+		status.RecordSessionStarted()
+	}
 
 	joined := ServerMessage{
 		Type: "joined",
-		Data: marshalData(JoinedMessage{Reflector: payload.Reflector, Module: string(moduleByte), Callsign: s.Callsign}),
+		Data: marshalData(JoinedMessage{Reflector: payload.Reflector, Module: string(moduleByte), Callsign: s.Callsign, CAN: s.CAN, Mode: s.Mode.String(), Destination: s.Destination, Signed: s.Stream != nil && s.Stream.Signed(), ListenOnly: s.ListenOnly}),
 	}
 	if err := writeJSON(mu, conn, joined); err != nil {
 		log.Warn("Error sending joined message", "session", s.ID, "err", err)
 	}
 }
 
+// handleScan replaces the channels monitored alongside the home module.
+// An empty list stops scanning.
+func (s *Session) handleScan(ctx context.Context, conn *websocket.Conn, mu *sync.Mutex, data json.RawMessage, newListenClient func(context.Context, string, string, byte) (*reflector.ReflectorClient, error)) {
+	var payload ScanMessage
+	if err := json.Unmarshal(data, &payload); err != nil {
+		errStr := fmt.Sprintf("Invalid scan payload: %v", err)
+		log.Warn("Invalid scan payload", "session", s.ID, "err", err)
+		sendError(conn, mu, errStr)
+		return
+	}
+	if s.Reflector == nil || s.home == nil {
+		log.Warn("Scan without a joined reflector", "session", s.ID)
+		sendError(conn, mu, "Not joined to a reflector")
+		return
+	}
+	if payload.Policy == "" {
+		payload.Policy = ScanPriority
+	}
+	if payload.Policy != ScanPriority && payload.Policy != ScanFirst {
+		errStr := fmt.Sprintf("Invalid scan policy: %s", payload.Policy)
+		log.Warn("Invalid scan policy", "session", s.ID, "policy", payload.Policy)
+		sendError(conn, mu, errStr)
+		return
+	}
+	if len(payload.Channels) > maxScanChannels {
+		errStr := fmt.Sprintf("Too many scan channels: max %d", maxScanChannels)
+		log.Warn("Too many scan channels", "session", s.ID, "count", len(payload.Channels))
+		sendError(conn, mu, errStr)
+		return
+	}
+
+	channels := make([]*scanChannel, 0, len(payload.Channels))
+	seen := map[ScanChannelMessage]bool{{Reflector: s.home.Reflector, Module: s.home.Module}: true}
+	for i, c := range payload.Channels {
+		if c.Reflector == "" {
+			c.Reflector = s.home.Reflector
+		}
+		if len(c.Module) != 1 || c.Module[0] < 'A' || c.Module[0] > 'Z' {
+			errStr := fmt.Sprintf("Invalid module: %s", c.Module)
+			log.Warn("Invalid scan module", "session", s.ID, "module", c.Module)
+			sendError(conn, mu, errStr)
+			return
+		}
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		channels = append(channels, &scanChannel{Reflector: c.Reflector, Module: c.Module, priority: i + 1})
+	}
+
+	s.stopScan()
+	s.scanPreempt.Store(payload.Policy == ScanPriority)
+	if err := s.startScan(ctx, channels, newListenClient); err != nil {
+		errStr := fmt.Sprintf("Failed to connect scan channel: %v", err)
+		log.Warn("Failed to connect scan channel", "session", s.ID, "err", err)
+		sendError(conn, mu, errStr)
+		return
+	}
+	log.Info("Session scanning", "session", s.ID, "channels", len(channels), "policy", payload.Policy)
+
+	resp := ScanMessage{Channels: make([]ScanChannelMessage, 0, len(channels)), Policy: payload.Policy}
+	for _, ch := range channels {
+		resp.Channels = append(resp.Channels, ScanChannelMessage{Reflector: ch.Reflector, Module: ch.Module})
+	}
+	if err := writeJSON(mu, conn, ServerMessage{Type: "scan", Data: marshalData(resp)}); err != nil {
+		log.Warn("Error sending scan message", "session", s.ID, "err", err)
+	}
+}
+
 func (s *Session) handlePTT(conn *websocket.Conn, mu *sync.Mutex, data json.RawMessage) {
 	var payload struct {
 		Active bool `json:"active"`
@@ -108,6 +349,24 @@ func (s *Session) handlePTT(conn *websocket.Conn, mu *sync.Mutex, data json.RawM
 		sendError(conn, mu, errStr)
 		return
 	}
+	if s.ListenOnly {
+		log.Warn("PTT on listen-only session", "session", s.ID)
+		sendError(conn, mu, errListenOnly)
+		return
+	}
+	// On a shared link only the session holding the transmitter may key
+	// up, and releasing PTT without holding it must not end its stream.
+	holding := true
+	if s.link != nil {
+		if !payload.Active {
+			holding = s.link.link.transmitting(s)
+			defer s.link.link.releaseTX(s)
+		} else if !s.link.link.acquireTX(s) {
+			log.Info("PTT denied; link busy", "session", s.ID)
+			sendError(conn, mu, errLinkBusy)
+			return
+		}
+	}
 	log.Info("Session PTT", "session", s.ID, "active", payload.Active)
 	status.RecordPTT()
 	if payload.Active && s.Stream != nil {
@@ -115,7 +374,7 @@ func (s *Session) handlePTT(conn *websocket.Conn, mu *sync.Mutex, data json.RawM
 			log.Warn("failed to start new stream", "session", s.ID, "err", err)
 		}
 	}
-	if !payload.Active && s.Stream != nil {
+	if !payload.Active && s.Stream != nil && holding {
 		if err := s.Stream.Finalize(); err != nil {
 			log.Warn("failed to finalize stream", "session", s.ID, "err", err)
 		}
@@ -131,10 +390,7 @@ func (s *Session) handlePTT(conn *websocket.Conn, mu *sync.Mutex, data json.RawM
 
 func (s *Session) handleDisconnect(_ *websocket.Conn, sendDisconnected func()) {
 	log.Info("Session requested disconnect", "session", s.ID)
-	if s.Reflector != nil {
-		s.Reflector.Disconnect()
-		s.Reflector = nil
-	}
+	s.leaveReflector()
 	sendDisconnected()
 }
 
@@ -169,6 +425,236 @@ func (s *Session) handleFormat(conn *websocket.Conn, mu *sync.Mutex, data json.R
 	}
 }
 
+func (s *Session) handlePosition(conn *websocket.Conn, mu *sync.Mutex, data json.RawMessage) {
+	var payload *PositionMessage
+	if err := json.Unmarshal(data, &payload); err != nil {
+		errStr := fmt.Sprintf("Invalid position payload: %v", err)
+		log.Warn("Invalid position payload", "session", s.ID, "err", err)
+		sendError(conn, mu, errStr)
+		return
+	}
+
+	var pos *m17.GNSS
+	if payload != nil {
+		g, err := payload.toGNSS()
+		if err != nil {
+			errStr := fmt.Sprintf("Invalid position: %v", err)
+			log.Warn("Invalid position", "session", s.ID, "err", err)
+			sendError(conn, mu, errStr)
+			return
+		}
+		pos = &g
+	}
+
+	if s.Stream != nil {
+		if err := s.Stream.SetPosition(pos); err != nil {
+			errStr := fmt.Sprintf("Failed to set position: %v", err)
+			log.Warn("Failed to set position", "session", s.ID, "err", err)
+			sendError(conn, mu, errStr)
+			return
+		}
+	}
+	s.Position = pos
+	log.Debug("Session position updated", "session", s.ID, "set", pos != nil)
+
+	resp := ServerMessage{Type: "position"}
+	if pos != nil {
+		resp.Data = marshalData(positionFromGNSS(*pos))
+	}
+	if err := writeJSON(mu, conn, resp); err != nil {
+		log.Warn("Error sending position message", "session", s.ID, "err", err)
+	}
+}
+
+func (s *Session) handleText(conn *websocket.Conn, mu *sync.Mutex, data json.RawMessage) {
+	var payload struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		errStr := fmt.Sprintf("Invalid text payload: %v", err)
+		log.Warn("Invalid text payload", "session", s.ID, "err", err)
+		sendError(conn, mu, errStr)
+		return
+	}
+	if len(payload.Text) > m17.MaxTextMessage {
+		errStr := fmt.Sprintf("Text too long: max %d bytes", m17.MaxTextMessage)
+		log.Warn("Text too long", "session", s.ID, "length", len(payload.Text))
+		sendError(conn, mu, errStr)
+		return
+	}
+
+	if s.Stream != nil {
+		if err := s.Stream.SetText(payload.Text); err != nil {
+			errStr := fmt.Sprintf("Failed to set text: %v", err)
+			log.Warn("Failed to set text", "session", s.ID, "err", err)
+			sendError(conn, mu, errStr)
+			return
+		}
+	}
+	s.Text = payload.Text
+	log.Debug("Session text updated", "session", s.ID, "text", s.Text)
+
+	resp := ServerMessage{
+		Type: "text",
+		Data: marshalData(TextMessage{Text: s.Text}),
+	}
+	if err := writeJSON(mu, conn, resp); err != nil {
+		log.Warn("Error sending text message", "session", s.ID, "err", err)
+	}
+}
+
+func (s *Session) handleKey(conn *websocket.Conn, mu *sync.Mutex, data json.RawMessage) {
+	var payload *struct {
+		Type string `json:"type"`
+		Key  string `json:"key"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		errStr := fmt.Sprintf("Invalid key payload: %v", err)
+		log.Warn("Invalid key payload", "session", s.ID, "err", err)
+		sendError(conn, mu, errStr)
+		return
+	}
+
+	var key *m17.Key
+	if payload != nil {
+		var typ m17.EncryptionType
+		switch strings.ToLower(payload.Type) {
+		case "aes":
+			typ = m17.EncryptionAES
+		case "scrambler":
+			typ = m17.EncryptionScrambler
+		default:
+			errStr := fmt.Sprintf("Unknown key type: %s", payload.Type)
+			log.Warn("Unknown key type", "session", s.ID, "type", payload.Type)
+			sendError(conn, mu, errStr)
+			return
+		}
+		raw, err := hex.DecodeString(payload.Key)
+		if err != nil {
+			errStr := fmt.Sprintf("Invalid key: %v", err)
+			log.Warn("Invalid key", "session", s.ID, "err", err)
+			sendError(conn, mu, errStr)
+			return
+		}
+		key, err = m17.NewKey(typ, raw)
+		if err != nil {
+			errStr := fmt.Sprintf("Invalid key: %v", err)
+			log.Warn("Invalid key", "session", s.ID, "err", err)
+			sendError(conn, mu, errStr)
+			return
+		}
+	}
+
+	if s.Stream != nil {
+		if err := s.Stream.SetKey(key); err != nil {
+			errStr := fmt.Sprintf("Failed to set key: %v", err)
+			log.Warn("Failed to set key", "session", s.ID, "err", err)
+			sendError(conn, mu, errStr)
+			return
+		}
+	}
+	s.Key = key
+	log.Info("Session key updated", "session", s.ID, "set", key != nil)
+
+	resp := ServerMessage{Type: "key"}
+	if key != nil {
+		resp.Data = marshalData(KeyMessage{Type: key.Type.String(), Bits: len(payload.Key) * 4})
+	}
+	if err := writeJSON(mu, conn, resp); err != nil {
+		log.Warn("Error sending key message", "session", s.ID, "err", err)
+	}
+}
+
+func (s *Session) handleSMS(conn *websocket.Conn, mu *sync.Mutex, data json.RawMessage) {
+	var payload struct {
+		Dst  string `json:"dst"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		errStr := fmt.Sprintf("Invalid sms payload: %v", err)
+		log.Warn("Invalid sms payload", "session", s.ID, "err", err)
+		sendError(conn, mu, errStr)
+		return
+	}
+	if s.ListenOnly {
+		log.Warn("SMS on listen-only session", "session", s.ID)
+		sendError(conn, mu, errListenOnly)
+		return
+	}
+	addr, err := m17.ParseAddress(payload.Dst)
+	if err != nil || addr == m17.AddressInvalid {
+		errStr := fmt.Sprintf("Invalid destination: %s", payload.Dst)
+		log.Warn("Invalid sms destination", "session", s.ID, "dst", payload.Dst, "err", err)
+		sendError(conn, mu, errStr)
+		return
+	}
+	if payload.Text == "" || len(payload.Text) > m17.MaxSMSLength {
+		errStr := fmt.Sprintf("Invalid sms length: must be 1-%d bytes", m17.MaxSMSLength)
+		log.Warn("Invalid sms length", "session", s.ID, "length", len(payload.Text))
+		sendError(conn, mu, errStr)
+		return
+	}
+
+	if err := s.SendSMS(addr.String(), payload.Text); err != nil {
+		errStr := fmt.Sprintf("Failed to send sms: %v", err)
+		log.Warn("Failed to send sms", "session", s.ID, "err", err)
+		sendError(conn, mu, errStr)
+		return
+	}
+	log.Info("Session sent SMS", "session", s.ID, "dst", addr.String())
+
+	resp := ServerMessage{
+		Type: "sms",
+		Data: marshalData(SMSMessage{Dst: addr.String(), Text: payload.Text}),
+	}
+	if err := writeJSON(mu, conn, resp); err != nil {
+		log.Warn("Error sending sms message", "session", s.ID, "err", err)
+	}
+}
+
+// handleData queues data for the data half of transmitted 1600 mode
+// frames.
+func (s *Session) handleData(conn *websocket.Conn, mu *sync.Mutex, data json.RawMessage) {
+	var payload struct {
+		Data []byte `json:"data"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		errStr := fmt.Sprintf("Invalid data payload: %v", err)
+		log.Warn("Invalid data payload", "session", s.ID, "err", err)
+		sendError(conn, mu, errStr)
+		return
+	}
+	if s.ListenOnly {
+		log.Warn("Data on listen-only session", "session", s.ID)
+		sendError(conn, mu, errListenOnly)
+		return
+	}
+	if s.Stream == nil {
+		sendError(conn, mu, "Not joined to a reflector")
+		return
+	}
+	if len(payload.Data) == 0 {
+		sendError(conn, mu, "Empty data")
+		return
+	}
+
+	queued, err := s.Stream.QueueData(payload.Data)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to queue data: %v", err)
+		log.Warn("Failed to queue data", "session", s.ID, "err", err)
+		sendError(conn, mu, errStr)
+		return
+	}
+
+	resp := ServerMessage{
+		Type: "data",
+		Data: marshalData(DataQueuedMessage{Queued: queued}),
+	}
+	if err := writeJSON(mu, conn, resp); err != nil {
+		log.Warn("Error sending data message", "session", s.ID, "err", err)
+	}
+}
+
 func (s *Session) handleUnknown(conn *websocket.Conn, mu *sync.Mutex, msgType string) {
 	errStr := fmt.Sprintf("Unknown message type: %s", msgType)
 	log.Warn("Unknown message type", "session", s.ID, "type", msgType)
@@ -2,10 +2,20 @@ package transport
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -97,6 +107,373 @@ func TestHandleWebSocketFlow(t *testing.T) {
 	}
 }
 
+func TestHandleJoinListenOnly(t *testing.T) {
+	manager := NewSessionManager()
+	var listenCalls int
+	cfg := WebSocketConfig{
+		NewReflectorClient: func(ctx context.Context, addr, callsign string, module byte) (*reflector.ReflectorClient, error) {
+			t.Error("listen-only join used CONN client")
+			return newMockReflector(callsign, module), nil
+		},
+		NewListenClient: func(ctx context.Context, addr, callsign string, module byte) (*reflector.ReflectorClient, error) {
+			listenCalls++
+			rc := newMockReflector(callsign, module)
+			rc.ListenOnly = true
+			return rc, nil
+		},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HandleWebSocket(manager, cfg, w, r)
+	}))
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+	hdr := http.Header{"Origin": {srv.URL}}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, hdr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	var msg ServerMessage
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "welcome" {
+		t.Fatalf("expected welcome, got %v, err %v", msg, err)
+	}
+
+	jb, _ := json.Marshal(map[string]any{"reflector": "127.0.0.1:17000", "module": "A", "listen_only": true})
+	conn.WriteJSON(ClientMessage{Type: "join", Data: jb})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "joined" {
+		t.Fatalf("expected joined, got %v, err %v", msg, err)
+	}
+	var joined JoinedMessage
+	if err := json.Unmarshal(msg.Data, &joined); err != nil {
+		t.Fatalf("unmarshal joined: %v", err)
+	}
+	if !joined.ListenOnly || !strings.HasPrefix(joined.Callsign, "SWL") {
+		t.Fatalf("unexpected joined message %+v", joined)
+	}
+	if listenCalls != 1 {
+		t.Fatalf("listen client created %d times, want 1", listenCalls)
+	}
+
+	pb, _ := json.Marshal(PTTMessage{Active: true})
+	conn.WriteJSON(ClientMessage{Type: "ptt", Data: pb})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "error" {
+		t.Fatalf("expected error for PTT, got %v, err %v", msg, err)
+	}
+
+	conn.WriteMessage(websocket.BinaryMessage, make([]byte, 160))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "error" {
+		t.Fatalf("expected error for audio, got %v, err %v", msg, err)
+	}
+}
+
+func TestHandleJoinSigningToken(t *testing.T) {
+	dir := t.TempDir()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	der, _ := x509.MarshalECPrivateKey(priv)
+	if err := os.WriteFile(filepath.Join(dir, "N0CALL.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	sum := sha256.Sum256([]byte("secret"))
+	if err := os.WriteFile(filepath.Join(dir, "N0CALL.token"), []byte(hex.EncodeToString(sum[:])), 0o600); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+
+	manager := NewSessionManager()
+	cfg := WebSocketConfig{
+		SigningKeyDir: dir,
+		NewReflectorClient: func(ctx context.Context, addr, callsign string, module byte) (*reflector.ReflectorClient, error) {
+			return newMockReflector(callsign, module), nil
+		},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HandleWebSocket(manager, cfg, w, r)
+	}))
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": {srv.URL}})
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	var msg ServerMessage
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "welcome" {
+		t.Fatalf("expected welcome, got %v, err %v", msg, err)
+	}
+
+	join := func(token string) (ServerMessage, JoinedMessage) {
+		t.Helper()
+		jb, _ := json.Marshal(map[string]string{"callsign": "N0CALL", "reflector": "127.0.0.1:17000", "module": "A", "signing_token": token})
+		conn.WriteJSON(ClientMessage{Type: "join", Data: jb})
+		var msg ServerMessage
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		var joined JoinedMessage
+		if msg.Type == "joined" {
+			if err := json.Unmarshal(msg.Data, &joined); err != nil {
+				t.Fatalf("unmarshal joined: %v", err)
+			}
+		}
+		return msg, joined
+	}
+
+	if msg, _ := join("guess"); msg.Type != "error" {
+		t.Fatalf("join with a wrong token: got %v, want error", msg)
+	}
+	if msg, joined := join(""); msg.Type != "joined" || joined.Signed {
+		t.Fatalf("join without a token: got %v %+v, want unsigned join", msg, joined)
+	}
+	if msg, joined := join("secret"); msg.Type != "joined" || !joined.Signed {
+		t.Fatalf("join with the token: got %v %+v, want signed join", msg, joined)
+	}
+}
+
+func TestHandleQSY(t *testing.T) {
+	manager := NewSessionManager()
+	clients := make(chan *reflector.ReflectorClient, 3)
+	cfg := WebSocketConfig{
+		NewReflectorClient: func(ctx context.Context, addr, callsign string, module byte) (*reflector.ReflectorClient, error) {
+			if module == 'Z' {
+				return nil, errors.New("no answer")
+			}
+			rc := newMockReflector(callsign, module)
+			clients <- rc
+			return rc, nil
+		},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HandleWebSocket(manager, cfg, w, r)
+	}))
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+	hdr := http.Header{"Origin": {srv.URL}}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, hdr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	var msg ServerMessage
+	expect := func(typ string) {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if err := conn.ReadJSON(&msg); err != nil || msg.Type != typ {
+			t.Fatalf("expected %s, got %v, err %v", typ, msg, err)
+		}
+	}
+	expectJoined := func(module string) {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if err := conn.ReadJSON(&msg); err != nil || msg.Type != "joined" {
+			t.Fatalf("expected joined, got %v, err %v", msg, err)
+		}
+		var joined JoinedMessage
+		if err := json.Unmarshal(msg.Data, &joined); err != nil {
+			t.Fatalf("unmarshal joined: %v", err)
+		}
+		if joined.Module != module || joined.Callsign != "TEST" {
+			t.Fatalf("unexpected joined message %+v", joined)
+		}
+	}
+	expectClosed := func(rc *reflector.ReflectorClient) {
+		t.Helper()
+		select {
+		case <-rc.Done():
+		case <-time.After(time.Second):
+			t.Fatal("old reflector link not torn down")
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "welcome" {
+		t.Fatalf("expected welcome, got %v, err %v", msg, err)
+	}
+
+	qb, _ := json.Marshal(map[string]string{"module": "B"})
+	conn.WriteJSON(ClientMessage{Type: "qsy", Data: qb})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "error" {
+		t.Fatalf("expected error for qsy before join, got %v, err %v", msg, err)
+	}
+
+	jb, _ := json.Marshal(map[string]string{"callsign": "TEST", "reflector": "127.0.0.1:17000", "module": "A"})
+	conn.WriteJSON(ClientMessage{Type: "join", Data: jb})
+	expectJoined("A")
+	first := <-clients
+
+	conn.WriteJSON(ClientMessage{Type: "qsy", Data: qb})
+	expectJoined("B")
+	expectClosed(first)
+	second := <-clients
+
+	jb, _ = json.Marshal(map[string]string{"callsign": "TEST", "reflector": "127.0.0.1:17000", "module": "C"})
+	conn.WriteJSON(ClientMessage{Type: "join", Data: jb})
+	expectJoined("C")
+	expectClosed(second)
+
+	// Tearing down the old links must not report the session as
+	// disconnected.
+	conn.WriteJSON(ClientMessage{Type: "ping"})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "pong" {
+		t.Fatalf("expected pong, got %v, err %v", msg, err)
+	}
+
+	// A QSY that fails to connect leaves the session without a reflector.
+	third := <-clients
+	qb, _ = json.Marshal(map[string]string{"module": "Z"})
+	conn.WriteJSON(ClientMessage{Type: "qsy", Data: qb})
+	expect("error")
+	expect("disconnected")
+	expectClosed(third)
+}
+
+func TestHandleScan(t *testing.T) {
+	manager := NewSessionManager()
+	listened := make(chan string, 4)
+	cfg := WebSocketConfig{
+		NewReflectorClient: func(ctx context.Context, addr, callsign string, module byte) (*reflector.ReflectorClient, error) {
+			return newMockReflector(callsign, module), nil
+		},
+		NewListenClient: func(ctx context.Context, addr, callsign string, module byte) (*reflector.ReflectorClient, error) {
+			listened <- addr + " " + string(module)
+			rc := newMockReflector(callsign, module)
+			rc.ListenOnly = true
+			return rc, nil
+		},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HandleWebSocket(manager, cfg, w, r)
+	}))
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+	hdr := http.Header{"Origin": {srv.URL}}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, hdr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	var msg ServerMessage
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "welcome" {
+		t.Fatalf("expected welcome, got %v, err %v", msg, err)
+	}
+
+	jb, _ := json.Marshal(map[string]string{"callsign": "TEST", "reflector": "127.0.0.1:17000", "module": "A"})
+	conn.WriteJSON(ClientMessage{Type: "join", Data: jb})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "joined" {
+		t.Fatalf("expected joined, got %v, err %v", msg, err)
+	}
+
+	sb, _ := json.Marshal(ScanMessage{Channels: []ScanChannelMessage{
+		{Module: "A"},
+		{Module: "B"},
+		{Reflector: "127.0.0.1:17001", Module: "C"},
+	}})
+	conn.WriteJSON(ClientMessage{Type: "scan", Data: sb})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "scan" {
+		t.Fatalf("expected scan, got %v, err %v", msg, err)
+	}
+	var scan ScanMessage
+	if err := json.Unmarshal(msg.Data, &scan); err != nil {
+		t.Fatalf("unmarshal scan: %v", err)
+	}
+	// The home module is not scanned again.
+	if len(scan.Channels) != 2 || scan.Policy != ScanPriority {
+		t.Fatalf("unexpected scan message %+v", scan)
+	}
+	for _, want := range []string{"127.0.0.1:17000 B", "127.0.0.1:17001 C"} {
+		if got := <-listened; got != want {
+			t.Fatalf("listen client for %q, want %q", got, want)
+		}
+	}
+
+	sb, _ = json.Marshal(ScanMessage{Channels: []ScanChannelMessage{{Module: "b"}}})
+	conn.WriteJSON(ClientMessage{Type: "scan", Data: sb})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "error" {
+		t.Fatalf("expected error for invalid module, got %v, err %v", msg, err)
+	}
+}
+
+func TestHandleData(t *testing.T) {
+	manager := NewSessionManager()
+	cfg := WebSocketConfig{
+		NewReflectorClient: func(ctx context.Context, addr, callsign string, module byte) (*reflector.ReflectorClient, error) {
+			return newMockReflector(callsign, module), nil
+		},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HandleWebSocket(manager, cfg, w, r)
+	}))
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+	hdr := http.Header{"Origin": {srv.URL}}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, hdr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	var msg ServerMessage
+	expect := func(typ string) {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if err := conn.ReadJSON(&msg); err != nil || msg.Type != typ {
+			t.Fatalf("expected %s, got %v, err %v", typ, msg, err)
+		}
+	}
+	expect("welcome")
+
+	db, _ := json.Marshal(map[string][]byte{"data": []byte("hello")})
+	conn.WriteJSON(ClientMessage{Type: "data", Data: db})
+	expect("error")
+
+	jb, _ := json.Marshal(map[string]string{"callsign": "TEST", "reflector": "127.0.0.1:17000", "module": "A"})
+	conn.WriteJSON(ClientMessage{Type: "join", Data: jb})
+	expect("joined")
+
+	conn.WriteJSON(ClientMessage{Type: "data", Data: db})
+	expect("error")
+
+	jb, _ = json.Marshal(map[string]string{"callsign": "TEST", "reflector": "127.0.0.1:17000", "module": "A", "mode": "1600"})
+	conn.WriteJSON(ClientMessage{Type: "join", Data: jb})
+	expect("joined")
+
+	conn.WriteJSON(ClientMessage{Type: "data", Data: db})
+	expect("data")
+	var queued DataQueuedMessage
+	if err := json.Unmarshal(msg.Data, &queued); err != nil {
+		t.Fatalf("unmarshal data: %v", err)
+	}
+	if queued.Queued != 8 {
+		t.Fatalf("queued %d bytes, want 8", queued.Queued)
+	}
+}
+
 func TestHandleJoinModuleValidation(t *testing.T) {
 	manager := NewSessionManager()
 	cfg := WebSocketConfig{
@@ -149,6 +526,72 @@ func TestHandleJoinModuleValidation(t *testing.T) {
 	}
 }
 
+func TestHandleJoinCANValidation(t *testing.T) {
+	manager := NewSessionManager()
+	cfg := WebSocketConfig{
+		NewReflectorClient: func(ctx context.Context, addr, callsign string, module byte) (*reflector.ReflectorClient, error) {
+			return newMockReflector(callsign, module), nil
+		},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HandleWebSocket(manager, cfg, w, r)
+	}))
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+	hdr := http.Header{"Origin": {srv.URL}}
+
+	tests := []struct {
+		name   string
+		can    any
+		expect string
+	}{
+		{"default", nil, "joined"},
+		{"valid", 7, "joined"},
+		{"max", 15, "joined"},
+		{"too_large", 16, "error"},
+		{"negative", -1, "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, _, err := websocket.DefaultDialer.Dial(wsURL, hdr)
+			if err != nil {
+				t.Fatalf("dial failed: %v", err)
+			}
+			defer conn.Close()
+
+			var msg ServerMessage
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			if err := conn.ReadJSON(&msg); err != nil || msg.Type != "welcome" {
+				t.Fatalf("expected welcome, got %v, err %v", msg, err)
+			}
+
+			joinPayload := map[string]any{"callsign": "TEST", "reflector": "127.0.0.1:17000", "module": "A"}
+			if tt.can != nil {
+				joinPayload["can"] = tt.can
+			}
+			jb, _ := json.Marshal(joinPayload)
+			conn.WriteJSON(ClientMessage{Type: "join", Data: jb})
+
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			if err := conn.ReadJSON(&msg); err != nil || msg.Type != tt.expect {
+				t.Fatalf("expected %s, got %v, err %v", tt.expect, msg, err)
+			}
+			if tt.expect == "joined" && tt.can != nil {
+				var joined JoinedMessage
+				if err := json.Unmarshal(msg.Data, &joined); err != nil {
+					t.Fatalf("unmarshal: %v", err)
+				}
+				if int(joined.CAN) != tt.can.(int) {
+					t.Fatalf("expected CAN %v, got %d", tt.can, joined.CAN)
+				}
+			}
+		})
+	}
+}
+
 func TestHandleWebSocketUnknown(t *testing.T) {
 	manager := NewSessionManager()
 	cfg := WebSocketConfig{}